@@ -0,0 +1,127 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// main.go - the command line of the benchmark
+//
+// Usage:
+//
+//	mochow-bench -endpoint http://127.0.0.1:8287 -account root -apikey xxx -database db -table t \
+//	    -mix vectorSearch=8,insert=2 -qps 500 -duration 60s -json result.json
+//	mochow-bench -stub -mix vectorSearch=1,query=1 -concurrency 16 -requests 100000
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/bench"
+	"github.com/baidu/mochow-sdk-go/v2/util/log"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", "", "endpoint of the Mochow service")
+	account := flag.String("account", "root", "account")
+	apiKey := flag.String("apikey", "", "api key")
+	database := flag.String("database", "bench", "database")
+	table := flag.String("table", "bench", "table")
+	mix := flag.String("mix", "vectorSearch=1", "operations and their weights, "+
+		"of insert, upsert, vectorSearch, bm25Search, hybridSearch and query")
+	qps := flag.Float64("qps", 0, "target rate, 0 for as fast as the workers go")
+	concurrency := flag.Int("concurrency", bench.DefaultConcurrency, "number of workers")
+	duration := flag.Duration("duration", 0, fmt.Sprintf(
+		"duration of the run if -requests is not set, %v if neither is set", bench.DefaultDuration))
+	requests := flag.Int64("requests", 0, "number of requests of the run")
+	batchSize := flag.Int("batch", bench.DefaultBatchSize, "rows per insert or upsert")
+	limit := flag.Uint("limit", bench.DefaultLimit, "limit of the searches")
+	vectorField := flag.String("vector-field", "", "float vector field searched, the first one by default")
+	bm25Index := flag.String("bm25-index", "", "inverted index searched, the first one by default")
+	keyStart := flag.Int64("key-start", 0, "first key inserted")
+	keySpace := flag.Int64("key-space", bench.DefaultKeySpace, "keys addressed before any insert")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the random operations")
+	timeout := flag.Int("timeout-ms", 0, "request timeout in milliseconds")
+	jsonPath := flag.String("json", "", "file to write the report as JSON")
+	stub := flag.Bool("stub", false, "run against a local stub server instead of -endpoint")
+	stubLatency := flag.Duration("stub-latency", 0, "latency of the stub server")
+	stubDimension := flag.Uint("stub-dimension", 128, "dimension of the vectors of the stub table")
+	flag.Parse()
+
+	log.SetLogLevel(log.ERROR)
+	if *stub {
+		server, err := bench.NewStubServer(*database, *table, bench.StubSchema(uint32(*stubDimension)), *stubLatency)
+		if err != nil {
+			fail(err)
+		}
+		defer server.Close()
+		*endpoint = server.URL
+		if len(*apiKey) == 0 {
+			*apiKey = "stub"
+		}
+	}
+	if len(*endpoint) == 0 {
+		fail(fmt.Errorf("-endpoint or -stub should be given"))
+	}
+	operations, err := bench.ParseMix(*mix)
+	if err != nil {
+		fail(err)
+	}
+	cli, err := mochow.NewClientWithConfig(&mochow.ClientConfiguration{
+		Account:          *account,
+		APIKey:           *apiKey,
+		Endpoint:         *endpoint,
+		RequestTimeoutMS: *timeout,
+		MaxRetry:         -1,
+	})
+	if err != nil {
+		fail(err)
+	}
+	report, err := bench.Run(cli, &bench.Options{
+		Database:      *database,
+		Table:         *table,
+		Mix:           operations,
+		QPS:           *qps,
+		Concurrency:   *concurrency,
+		Duration:      *duration,
+		Requests:      *requests,
+		BatchSize:     *batchSize,
+		VectorField:   *vectorField,
+		BM25IndexName: *bm25Index,
+		Limit:         uint32(*limit),
+		KeyStart:      *keyStart,
+		KeySpace:      *keySpace,
+		Seed:          *seed,
+	})
+	if err != nil {
+		fail(err)
+	}
+	report.WriteTable(os.Stdout)
+	if len(*jsonPath) > 0 {
+		file, err := os.Create(*jsonPath)
+		if err != nil {
+			fail(err)
+		}
+		defer file.Close()
+		if err := report.WriteJSON(file); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "mochow-bench:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// main.go - the command line of the JSONL and CSV import
+//
+// Usage:
+//
+//	mochow-import -endpoint http://127.0.0.1:8287 -account root -apikey xxx -database db -table t \
+//	    -map title=name,embedding=vector -rejects rejects.jsonl -upsert docs.csv
+//	mochow-import ... -offset 120000 -rejects rejects.jsonl docs.csv
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/importer"
+	"github.com/baidu/mochow-sdk-go/v2/util/log"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", "", "endpoint of the Mochow service")
+	account := flag.String("account", "root", "account")
+	apiKey := flag.String("apikey", "", "api key")
+	database := flag.String("database", "", "database")
+	table := flag.String("table", "", "table")
+	format := flag.String("format", "", "jsonl or csv, given by the extension of the file by default")
+	comma := flag.String("comma", "", "separator of the CSV columns, ',' by default and tab for .tsv")
+	mapping := flag.String("map", "", "columns renamed to fields, e.g. title=name,extra=- to leave out extra")
+	ignoreUnknown := flag.Bool("ignore-unknown", false, "leave out the columns which are not fields")
+	batchSize := flag.Int("batch", importer.DefaultBatchSize, "records per batch")
+	upsert := flag.Bool("upsert", false, "upsert the rows instead of inserting them")
+	rejects := flag.String("rejects", "", "file to write the rejected records, appended when resuming")
+	maxRejects := flag.Int64("max-rejects", 0, "stop after more records rejected, 0 for no limit")
+	offset := flag.Int64("offset", 0, "records skipped, not lines, e.g. the next offset of a failed import")
+	limit := flag.Int64("limit", 0, "max records imported, 0 for all")
+	timeout := flag.Int("timeout-ms", 0, "request timeout in milliseconds")
+	flag.Parse()
+
+	log.SetLogLevel(log.ERROR)
+	if flag.NArg() != 1 {
+		fail(fmt.Errorf("a file to import should be given"))
+	}
+	if len(*endpoint) == 0 {
+		fail(fmt.Errorf("-endpoint should be given"))
+	}
+	options := &importer.Options{
+		Database:      *database,
+		Table:         *table,
+		Format:        importer.Format(*format),
+		IgnoreUnknown: *ignoreUnknown,
+		BatchSize:     *batchSize,
+		Upsert:        *upsert,
+		MaxRejects:    *maxRejects,
+		Offset:        *offset,
+		Limit:         *limit,
+	}
+	if len(*comma) > 0 {
+		r, size := utf8.DecodeRuneInString(*comma)
+		if size != len(*comma) {
+			fail(fmt.Errorf("-comma should be a single character"))
+		}
+		options.Comma = r
+	}
+	if len(*mapping) > 0 {
+		options.Mapping = make(map[string]string)
+		for _, item := range strings.Split(*mapping, ",") {
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+				fail(fmt.Errorf("invalid mapping '%s', expect column=field", item))
+			}
+			options.Mapping[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	if len(*rejects) > 0 {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if *offset > 0 {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		file, err := os.OpenFile(*rejects, flags, 0644)
+		if err != nil {
+			fail(err)
+		}
+		defer file.Close()
+		options.Rejects = file
+	}
+	cli, err := mochow.NewClientWithConfig(&mochow.ClientConfiguration{
+		Account:          *account,
+		APIKey:           *apiKey,
+		Endpoint:         *endpoint,
+		RequestTimeoutMS: *timeout,
+	})
+	if err != nil {
+		fail(err)
+	}
+	result, err := importer.ImportFile(cli, flag.Arg(0), options)
+	fmt.Printf("%d records read, %d rows written, %d rejected, next offset %d\n",
+		result.Records, result.Rows, result.Rejected, result.NextOffset)
+	if err != nil {
+		fail(fmt.Errorf("%v, resume with -offset %d", err, result.NextOffset))
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "mochow-import:", err)
+	os.Exit(1)
+}
@@ -5,11 +5,20 @@
 package sdk
 
 import (
-	_ "github.com/baidu/mochow-sdk-go/v2/auth"       // register auth package
-	_ "github.com/baidu/mochow-sdk-go/v2/client"     // register client package
-	_ "github.com/baidu/mochow-sdk-go/v2/http"       // register http package
-	_ "github.com/baidu/mochow-sdk-go/v2/mochow"     // register mochow package
-	_ "github.com/baidu/mochow-sdk-go/v2/mochow/api" // register api package
-	_ "github.com/baidu/mochow-sdk-go/v2/util"       // register util package
-	_ "github.com/baidu/mochow-sdk-go/v2/util/log"   // register log package
+	_ "github.com/baidu/mochow-sdk-go/v2/auth"             // register auth package
+	_ "github.com/baidu/mochow-sdk-go/v2/client"           // register client package
+	_ "github.com/baidu/mochow-sdk-go/v2/http"             // register http package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow"           // register mochow package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow/api"       // register api package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow/bench"     // register bench package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow/dataset"   // register dataset package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow/embedding" // register embedding package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow/eval"      // register eval package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow/export"    // register export package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow/importer"  // register importer package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow/ingest"    // register ingest package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow/rerank"    // register rerank package
+	_ "github.com/baidu/mochow-sdk-go/v2/mochow/sparse"    // register sparse package
+	_ "github.com/baidu/mochow-sdk-go/v2/util"             // register util package
+	_ "github.com/baidu/mochow-sdk-go/v2/util/log"         // register log package
 )
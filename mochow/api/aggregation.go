@@ -0,0 +1,378 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// aggregation.go - client side count, distinct and group by over the rows matching a filter
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// DefaultMaxGroups bounds the number of distinct values or groups kept in memory
+const DefaultMaxGroups = 100000
+
+type AggregateFunc string
+
+const (
+	AggregateCount AggregateFunc = "count"
+	AggregateSum   AggregateFunc = "sum"
+	AggregateMin   AggregateFunc = "min"
+	AggregateMax   AggregateFunc = "max"
+	AggregateAvg   AggregateFunc = "avg"
+)
+
+// Aggregate computes Func over the numeric values of Field in each group, Field is ignored by count
+type Aggregate struct {
+	Func  AggregateFunc
+	Field string
+}
+
+// Name returns the key of the aggregate in GroupByRowResult, e.g. "sum(price)" or "count"
+func (a Aggregate) Name() string {
+	if a.Func == AggregateCount {
+		return string(a.Func)
+	}
+	return fmt.Sprintf("%s(%s)", a.Func, a.Field)
+}
+
+// CountRowArgs counts the rows matching the filter. When ShardFilters is set, each shard is
+// scanned concurrently with "(Filter) AND (shard)", the shards should not overlap.
+type CountRowArgs struct {
+	Database        string
+	Table           string
+	Filter          string
+	ShardFilters    []string
+	BatchSize       int
+	ReadConsistency ReadConsistency
+}
+
+// DistinctRowArgs collects the distinct values of the field in the rows matching the filter,
+// at most MaxValues values are kept in memory
+type DistinctRowArgs struct {
+	Database        string
+	Table           string
+	Field           string
+	Filter          string
+	ShardFilters    []string
+	BatchSize       int
+	MaxValues       int
+	ReadConsistency ReadConsistency
+}
+
+type DistinctRowResult struct {
+	Values []interface{}
+}
+
+// GroupByRowArgs groups the rows matching the filter by the value of the field and computes the
+// aggregates in each group, at most MaxGroups groups are kept in memory
+type GroupByRowArgs struct {
+	Database        string
+	Table           string
+	Field           string
+	Aggregates      []Aggregate
+	Filter          string
+	ShardFilters    []string
+	BatchSize       int
+	MaxGroups       int
+	ReadConsistency ReadConsistency
+}
+
+type RowGroup struct {
+	Value      interface{}
+	Count      uint64
+	Aggregates map[string]float64 // keyed by Aggregate.Name(), absent if no numeric value found
+}
+
+// GroupByRowResult lists the groups by descending count
+type GroupByRowResult struct {
+	Groups []RowGroup
+}
+
+type scanScope struct {
+	database        string
+	table           string
+	filter          string
+	shardFilters    []string
+	batchSize       int
+	readConsistency ReadConsistency
+	projections     []string
+}
+
+// scanRows scans the rows of every shard concurrently, fn is never called concurrently
+func scanRows(cli client.Client, scope *scanScope, fn func(rows []Row) error) error {
+	filters := []string{scope.filter}
+	if len(scope.shardFilters) > 0 {
+		filters = make([]string, 0, len(scope.shardFilters))
+		for _, shard := range scope.shardFilters {
+			if len(scope.filter) == 0 {
+				filters = append(filters, shard)
+			} else {
+				filters = append(filters, fmt.Sprintf("(%s) AND (%s)", scope.filter, shard))
+			}
+		}
+	}
+
+	// the first failure stops the scans of the other shards
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	stop := make(chan struct{})
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			close(stop)
+		}
+	}
+	for _, filter := range filters {
+		wg.Add(1)
+		go func(filter string) {
+			defer wg.Done()
+			iterator := NewSelectIterator(cli, &SelectRowArgs{
+				Database:        scope.database,
+				Table:           scope.table,
+				Filter:          filter,
+				Limit:           uint64(scope.batchSize),
+				Projections:     scope.projections,
+				ReadConsistency: scope.readConsistency,
+			})
+			defer iterator.Close()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				rows, err := iterator.Next()
+				if err != nil {
+					fail(err)
+					return
+				}
+				if rows == nil {
+					return
+				}
+				mu.Lock()
+				if firstErr == nil {
+					err = fn(rows)
+				}
+				mu.Unlock()
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+		}(filter)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// CountRow counts the rows matching the filter by scanning their primary keys
+func CountRow(cli client.Client, args *CountRowArgs) (uint64, error) {
+	primaryKeys, _, err := describeKeyFields(cli, args.Database, args.Table)
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	err = scanRows(cli, &scanScope{
+		database:        args.Database,
+		table:           args.Table,
+		filter:          args.Filter,
+		shardFilters:    args.ShardFilters,
+		batchSize:       args.BatchSize,
+		readConsistency: args.ReadConsistency,
+		projections:     primaryKeys,
+	}, func(rows []Row) error {
+		count += uint64(len(rows))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// DistinctRow returns the distinct values of the field, in the order they are found
+func DistinctRow(cli client.Client, args *DistinctRowArgs) (*DistinctRowResult, error) {
+	if len(args.Field) == 0 {
+		return nil, fmt.Errorf("field should not be empty")
+	}
+	maxValues := args.MaxValues
+	if maxValues <= 0 {
+		maxValues = DefaultMaxGroups
+	}
+	seen := make(map[string]bool)
+	result := &DistinctRowResult{Values: make([]interface{}, 0)}
+	err := scanRows(cli, &scanScope{
+		database:        args.Database,
+		table:           args.Table,
+		filter:          args.Filter,
+		shardFilters:    args.ShardFilters,
+		batchSize:       args.BatchSize,
+		readConsistency: args.ReadConsistency,
+		projections:     []string{args.Field},
+	}, func(rows []Row) error {
+		for _, row := range rows {
+			value := row.Fields[args.Field]
+			key := canonicalValue(value)
+			if seen[key] {
+				continue
+			}
+			if len(seen) >= maxValues {
+				return fmt.Errorf("number of distinct values of '%s' exceeds %d", args.Field, maxValues)
+			}
+			seen[key] = true
+			result.Values = append(result.Values, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type aggregateState struct {
+	count    uint64
+	sum      float64
+	min, max float64
+}
+
+type groupState struct {
+	value  interface{}
+	count  uint64
+	states []aggregateState
+}
+
+// GroupByRow groups the rows by the value of the field and computes the aggregates of each group
+func GroupByRow(cli client.Client, args *GroupByRowArgs) (*GroupByRowResult, error) {
+	if len(args.Field) == 0 {
+		return nil, fmt.Errorf("field should not be empty")
+	}
+	maxGroups := args.MaxGroups
+	if maxGroups <= 0 {
+		maxGroups = DefaultMaxGroups
+	}
+	fields := []string{args.Field}
+	for _, aggregate := range args.Aggregates {
+		switch aggregate.Func {
+		case AggregateCount:
+			continue
+		case AggregateSum, AggregateMin, AggregateMax, AggregateAvg:
+		default:
+			return nil, fmt.Errorf("unsupported aggregate function '%s'", aggregate.Func)
+		}
+		if len(aggregate.Field) == 0 {
+			return nil, fmt.Errorf("field of aggregate '%s' should not be empty", aggregate.Func)
+		}
+		fields = append(fields, aggregate.Field)
+	}
+	projections, _ := appendProjections(nil, fields)
+
+	groups := make(map[string]*groupState)
+	err := scanRows(cli, &scanScope{
+		database:        args.Database,
+		table:           args.Table,
+		filter:          args.Filter,
+		shardFilters:    args.ShardFilters,
+		batchSize:       args.BatchSize,
+		readConsistency: args.ReadConsistency,
+		projections:     projections,
+	}, func(rows []Row) error {
+		for _, row := range rows {
+			value := row.Fields[args.Field]
+			key := canonicalValue(value)
+			group, ok := groups[key]
+			if !ok {
+				if len(groups) >= maxGroups {
+					return fmt.Errorf("number of groups of '%s' exceeds %d", args.Field, maxGroups)
+				}
+				group = &groupState{value: value, states: make([]aggregateState, len(args.Aggregates))}
+				groups[key] = group
+			}
+			group.count++
+			for i, aggregate := range args.Aggregates {
+				if aggregate.Func == AggregateCount {
+					continue
+				}
+				num, ok := toFloat64(row.Fields[aggregate.Field])
+				if !ok {
+					continue
+				}
+				state := &group.states[i]
+				if state.count == 0 || num < state.min {
+					state.min = num
+				}
+				if state.count == 0 || num > state.max {
+					state.max = num
+				}
+				state.count++
+				state.sum += num
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if groups[keys[i]].count != groups[keys[j]].count {
+			return groups[keys[i]].count > groups[keys[j]].count
+		}
+		return keys[i] < keys[j]
+	})
+	result := &GroupByRowResult{Groups: make([]RowGroup, 0, len(keys))}
+	for _, key := range keys {
+		group := groups[key]
+		rowGroup := RowGroup{
+			Value:      group.value,
+			Count:      group.count,
+			Aggregates: make(map[string]float64, len(args.Aggregates)),
+		}
+		for i, aggregate := range args.Aggregates {
+			state := group.states[i]
+			switch aggregate.Func {
+			case AggregateCount:
+				rowGroup.Aggregates[aggregate.Name()] = float64(group.count)
+				continue
+			}
+			if state.count == 0 {
+				continue
+			}
+			switch aggregate.Func {
+			case AggregateSum:
+				rowGroup.Aggregates[aggregate.Name()] = state.sum
+			case AggregateMin:
+				rowGroup.Aggregates[aggregate.Name()] = state.min
+			case AggregateMax:
+				rowGroup.Aggregates[aggregate.Name()] = state.max
+			case AggregateAvg:
+				rowGroup.Aggregates[aggregate.Name()] = state.sum / float64(state.count)
+			}
+		}
+		result.Groups = append(result.Groups, rowGroup)
+	}
+	return result, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// batch_query.go - batch query which maps the returned rows to the requested keys
+
+package api
+
+import (
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// KeyedBatchQueryRowResult maps the rows of a batch query to the keys of the request
+type KeyedBatchQueryRowResult struct {
+	// Rows is aligned with the keys of the request, the row is nil if the key is not found
+	Rows []*Row
+	// RowsByKey maps the PrimaryKeyString of every found key to its row
+	RowsByKey map[string]*Row
+	// MissingKeys lists the keys not found, in request order and without duplicates
+	MissingKeys []QueryKey
+}
+
+// Get returns the row of the given primary key
+func (r *KeyedBatchQueryRowResult) Get(primaryKey map[string]interface{}) (*Row, bool) {
+	row, ok := r.RowsByKey[PrimaryKeyString(primaryKey)]
+	return row, ok
+}
+
+// BatchQueryRowByKeys queries the rows of the keys and reports which row belongs to which key.
+// Duplicated keys are queried only once. The request is split as ChunkedBatchQueryRow does when
+// opts is not nil, keys of the failed chunks are neither found nor missing.
+func BatchQueryRowByKeys(cli client.Client, args *BatchQueryRowArgs, opts *ChunkOptions) (*KeyedBatchQueryRowResult, error) {
+	// de-duplicate the keys
+	keyStrings := make([]string, len(args.Keys))
+	uniqueKeys := make([]QueryKey, 0, len(args.Keys))
+	seen := make(map[string]bool, len(args.Keys))
+	for i, key := range args.Keys {
+		keyStrings[i] = PrimaryKeyString(key.PrimaryKey)
+		if !seen[keyStrings[i]] {
+			seen[keyStrings[i]] = true
+			uniqueKeys = append(uniqueKeys, key)
+		}
+	}
+
+	// primary key fields are needed in the rows to map them to the keys
+	keyFields := primaryKeyFields(uniqueKeys)
+	queryArgs, addedProjections := withProjections(args, keyFields)
+	uniqueArgs := *queryArgs
+	uniqueArgs.Keys = uniqueKeys
+
+	result := &KeyedBatchQueryRowResult{
+		Rows:        make([]*Row, len(args.Keys)),
+		RowsByKey:   make(map[string]*Row, len(uniqueKeys)),
+		MissingKeys: make([]QueryKey, 0),
+	}
+	if len(uniqueKeys) == 0 {
+		return result, nil
+	}
+	queryResult, err := ChunkedBatchQueryRow(cli, &uniqueArgs, opts)
+	if queryResult == nil {
+		return nil, err
+	}
+
+	for i := range queryResult.Row {
+		row := &queryResult.Row[i]
+		key := rowKeyString(row.Fields, keyFields)
+		for _, field := range addedProjections {
+			delete(row.Fields, field)
+		}
+		result.RowsByKey[key] = row
+	}
+	for i, key := range keyStrings {
+		result.Rows[i] = result.RowsByKey[key]
+	}
+
+	failed := make(map[int]bool)
+	if partialErr, ok := err.(*PartialFailureError); ok {
+		for _, offset := range partialErr.FailedOffsets() {
+			failed[offset] = true
+		}
+	}
+	for i, key := range uniqueKeys {
+		if _, ok := result.RowsByKey[PrimaryKeyString(key.PrimaryKey)]; !ok && !failed[i] {
+			result.MissingKeys = append(result.MissingKeys, key)
+		}
+	}
+	return result, err
+}
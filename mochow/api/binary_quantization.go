@@ -0,0 +1,143 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// binary_quantization.go - quantize float vectors to binary vectors and search them in two stages
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// BinaryQuantizer sets the i-th bit of the binary vector when the i-th value of the float vector
+// is greater than the i-th threshold. The bits are packed from the lowest bit of the first byte.
+type BinaryQuantizer struct {
+	thresholds FloatVector // nil for zero thresholds
+}
+
+// NewSignQuantizer returns the quantizer keeping the sign of the values
+func NewSignQuantizer() *BinaryQuantizer {
+	return &BinaryQuantizer{}
+}
+
+// NewMeanQuantizer returns the quantizer comparing the values with the mean of each dimension
+// over the sample vectors, which suits embeddings not centered on zero
+func NewMeanQuantizer(samples []FloatVector) (*BinaryQuantizer, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("samples should not be empty")
+	}
+	dimension := len(samples[0])
+	sums := make([]float64, dimension)
+	for _, sample := range samples {
+		if len(sample) != dimension {
+			return nil, fmt.Errorf("dimension mismatch: %d and %d", dimension, len(sample))
+		}
+		for i, v := range sample {
+			sums[i] += float64(v)
+		}
+	}
+	thresholds := make(FloatVector, dimension)
+	for i, sum := range sums {
+		thresholds[i] = float32(sum / float64(len(samples)))
+	}
+	return &BinaryQuantizer{thresholds: thresholds}, nil
+}
+
+// Thresholds returns the thresholds of the dimensions, nil for a sign quantizer
+func (q *BinaryQuantizer) Thresholds() FloatVector {
+	return q.thresholds
+}
+
+// Quantize returns the binary vector of the float vector, of (dimension + 7) / 8 bytes
+func (q *BinaryQuantizer) Quantize(vector FloatVector) (BinaryVector, error) {
+	if q.thresholds != nil && len(q.thresholds) != len(vector) {
+		return nil, fmt.Errorf("dimension mismatch: %d and %d", len(q.thresholds), len(vector))
+	}
+	binary := make(BinaryVector, (len(vector)+7)/8)
+	for i, v := range vector {
+		var threshold float32
+		if q.thresholds != nil {
+			threshold = q.thresholds[i]
+		}
+		if v > threshold {
+			binary[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return binary, nil
+}
+
+// QuantizeRows fills the binary field of the rows from their float field, so that the binary
+// copies are written together with the rows. Rows without the float field are left untouched.
+func (q *BinaryQuantizer) QuantizeRows(rows []Row, floatField, binaryField string) error {
+	for i := range rows {
+		if _, ok := rows[i].Fields[floatField]; !ok {
+			continue
+		}
+		vector, err := RowFloatVector(rows[i], floatField)
+		if err != nil {
+			return err
+		}
+		binary, err := q.Quantize(vector)
+		if err != nil {
+			return err
+		}
+		rows[i].Fields[binaryField] = binary
+	}
+	return nil
+}
+
+// QuantizedSearchArgs searches Request, a topk request on a float vector field, in two stages:
+// the rows closest to the quantized query are searched on BinaryField, which holds the binary
+// copies of the float field, then they are re-scored by their exact distances on the float
+// field as RescoreOptions describe. Quantizer defaults to a sign quantizer and should be the
+// one quantizing the rows.
+type QuantizedSearchArgs struct {
+	Database    string
+	Table       string
+	Request     *VectorTopkSearchRequest
+	BinaryField string
+	Quantizer   *BinaryQuantizer
+	Rescore     RescoreOptions
+}
+
+func QuantizedSearch(cli client.Client, args *QuantizedSearchArgs) (*SearchResult, error) {
+	if args.Request == nil {
+		return nil, fmt.Errorf("request should not be nil")
+	}
+	query, ok := args.Request.vector.(FloatVector)
+	if !ok {
+		return nil, fmt.Errorf("quantized search only supports FloatVector")
+	}
+	if len(args.BinaryField) == 0 {
+		return nil, fmt.Errorf("binary field should not be empty")
+	}
+	quantizer := args.Quantizer
+	if quantizer == nil {
+		quantizer = NewSignQuantizer()
+	}
+	binary, err := quantizer.Quantize(query)
+	if err != nil {
+		return nil, err
+	}
+	cloned, err := cloneSearchRequest(args.Request)
+	if err != nil {
+		return nil, err
+	}
+	firstStage := cloned.(*VectorTopkSearchRequest)
+	firstStage.vectorField = args.BinaryField
+	firstStage.vector = binary
+	return rescoreTopk(cli, args.Database, args.Table, firstStage, args.Request.vectorField, query, &args.Rescore)
+}
@@ -0,0 +1,335 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// embedding.go - fill the vector fields of a table from text fields by an embedder
+
+package api
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// DefaultEmbeddingBatchSize is the number of texts per Embed call if not configured
+const DefaultEmbeddingBatchSize = 32
+
+// Embedder turns texts into vectors, one FloatVector or SparseFloatVector per text in order
+type Embedder interface {
+	Embed(texts []string) ([]Vector, error)
+}
+
+// EmbeddingField maps the text field of a table to the vector field holding its embedding
+type EmbeddingField struct {
+	TextField   string
+	VectorField string
+	Embedder    Embedder
+}
+
+// EmbeddingTableArgs describes the table handle. BatchSize bounds the number of texts per Embed
+// call and CacheSize the number of embeddings kept in a LRU cache, 0 disables the cache.
+type EmbeddingTableArgs struct {
+	Database  string
+	Table     string
+	Fields    []EmbeddingField
+	BatchSize int
+	CacheSize int
+}
+
+// EmbeddingTable is a table handle embedding the text fields of rows on insert and upsert, and
+// embedding the text queries of searches
+type EmbeddingTable struct {
+	cli          client.Client
+	chunkOptions *ChunkOptions
+	database     string
+	table        string
+	fields       map[string]*embeddingField // by vector field
+	order        []string
+	batchSize    int
+	cache        *embeddingCache
+}
+
+type embeddingField struct {
+	EmbeddingField
+	fieldType FieldType
+	dimension uint32
+}
+
+// NewEmbeddingTable checks the vector fields against the schema of the table and returns the
+// handle, the rows are inserted and upserted as ChunkedInsertRow and ChunkedUpsertRow with opts
+func NewEmbeddingTable(cli client.Client, args *EmbeddingTableArgs, opts *ChunkOptions) (*EmbeddingTable, error) {
+	if len(args.Fields) == 0 {
+		return nil, fmt.Errorf("embedding fields should not be empty")
+	}
+	if args.BatchSize < 0 || args.CacheSize < 0 {
+		return nil, fmt.Errorf("batch size and cache size should not be negative")
+	}
+	desc, err := DescTable(cli, &DescTableArgs{Database: args.Database, Table: args.Table})
+	if err != nil {
+		return nil, err
+	}
+	if desc.Table == nil || desc.Table.Schema == nil {
+		return nil, fmt.Errorf("schema of table '%s' is not available", args.Table)
+	}
+	schema := make(map[string]FieldSchema, len(desc.Table.Schema.Fields))
+	for _, field := range desc.Table.Schema.Fields {
+		schema[field.FieldName] = field
+	}
+
+	t := &EmbeddingTable{
+		cli:          cli,
+		chunkOptions: opts,
+		database:     args.Database,
+		table:        args.Table,
+		fields:       make(map[string]*embeddingField, len(args.Fields)),
+		batchSize:    args.BatchSize,
+	}
+	if t.batchSize == 0 {
+		t.batchSize = DefaultEmbeddingBatchSize
+	}
+	if args.CacheSize > 0 {
+		t.cache = newEmbeddingCache(args.CacheSize)
+	}
+	for _, field := range args.Fields {
+		if field.Embedder == nil {
+			return nil, fmt.Errorf("embedder of field '%s' should not be nil", field.VectorField)
+		}
+		if _, ok := t.fields[field.VectorField]; ok {
+			return nil, fmt.Errorf("vector field '%s' is mapped more than once", field.VectorField)
+		}
+		vectorSchema, ok := schema[field.VectorField]
+		if !ok {
+			return nil, fmt.Errorf("field '%s' does not exist in table '%s'", field.VectorField, args.Table)
+		}
+		if vectorSchema.FieldType != FieldTypeFloatVector && vectorSchema.FieldType != FieldTypeSparseVector {
+			return nil, fmt.Errorf("field '%s' of type %s could not hold embeddings",
+				field.VectorField, vectorSchema.FieldType)
+		}
+		if _, ok := schema[field.TextField]; !ok {
+			return nil, fmt.Errorf("field '%s' does not exist in table '%s'", field.TextField, args.Table)
+		}
+		t.fields[field.VectorField] = &embeddingField{
+			EmbeddingField: field,
+			fieldType:      vectorSchema.FieldType,
+			dimension:      vectorSchema.Dimension,
+		}
+		t.order = append(t.order, field.VectorField)
+	}
+	return t, nil
+}
+
+// InsertRow fills the vector fields of the rows and inserts them
+func (t *EmbeddingTable) InsertRow(rows []Row) (*InsertRowResult, error) {
+	if err := t.EmbedRows(rows); err != nil {
+		return nil, err
+	}
+	return ChunkedInsertRow(t.cli, &InsertRowArgs{Database: t.database, Table: t.table, Rows: rows}, t.chunkOptions)
+}
+
+// UpsertRow fills the vector fields of the rows and upserts them
+func (t *EmbeddingTable) UpsertRow(rows []Row) (*UpsertRowResult, error) {
+	if err := t.EmbedRows(rows); err != nil {
+		return nil, err
+	}
+	return ChunkedUpsertRow(t.cli, &UpsertRowArg{Database: t.database, Table: t.table, Rows: rows}, t.chunkOptions)
+}
+
+// EmbedRows fills the vector fields of the rows in place from their text fields. Vector fields
+// already set and rows without the text field are left untouched.
+func (t *EmbeddingTable) EmbedRows(rows []Row) error {
+	for _, vectorField := range t.order {
+		field := t.fields[vectorField]
+		texts := make([]string, 0)
+		targets := make([]int, 0)
+		for i, row := range rows {
+			if _, ok := row.Fields[field.VectorField]; ok {
+				continue
+			}
+			value, ok := row.Fields[field.TextField]
+			if !ok || value == nil {
+				continue
+			}
+			text, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("field '%s' of row %d is not a string", field.TextField, i)
+			}
+			texts = append(texts, text)
+			targets = append(targets, i)
+		}
+		vectors, err := t.embed(field, texts)
+		if err != nil {
+			return err
+		}
+		for i, target := range targets {
+			rows[target].Fields[field.VectorField] = vectors[i]
+		}
+	}
+	return nil
+}
+
+// EmbedQuery embeds the text for a search on the vector field
+func (t *EmbeddingTable) EmbedQuery(vectorField, text string) (Vector, error) {
+	field, ok := t.fields[vectorField]
+	if !ok {
+		return nil, fmt.Errorf("field '%s' has no embedder", vectorField)
+	}
+	vectors, err := t.embed(field, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// NewTopkSearchRequest returns a topk search request on the vector field with the embedding of
+// the text, the request could be refined before passed to VectorSearch
+func (t *EmbeddingTable) NewTopkSearchRequest(vectorField, text string, limit uint32) (*VectorTopkSearchRequest, error) {
+	vector, err := t.EmbedQuery(vectorField, text)
+	if err != nil {
+		return nil, err
+	}
+	return VectorTopkSearchRequest{}.New(vectorField, vector, limit), nil
+}
+
+// VectorSearch searches the table by the request
+func (t *EmbeddingTable) VectorSearch(request vectorSearchRequest) (*SearchResult, error) {
+	return VectorSearch(t.cli, &VectorSearchArgs{Database: t.database, Table: t.table, Request: request})
+}
+
+// SearchText searches the top limit rows closest to the text on the vector field
+func (t *EmbeddingTable) SearchText(vectorField, text string, limit uint32) (*SearchResult, error) {
+	request, err := t.NewTopkSearchRequest(vectorField, text, limit)
+	if err != nil {
+		return nil, err
+	}
+	return t.VectorSearch(request)
+}
+
+// embed returns the vectors of the texts, taking the cached ones and embedding the others by
+// batches with duplicated texts embedded once
+func (t *EmbeddingTable) embed(field *embeddingField, texts []string) ([]Vector, error) {
+	vectors := make([]Vector, len(texts))
+	pending := make(map[string][]int)
+	missing := make([]string, 0)
+	for i, text := range texts {
+		if t.cache != nil {
+			if vector, ok := t.cache.get(field.VectorField, text); ok {
+				vectors[i] = vector
+				continue
+			}
+		}
+		if _, ok := pending[text]; !ok {
+			missing = append(missing, text)
+		}
+		pending[text] = append(pending[text], i)
+	}
+
+	for start := 0; start < len(missing); start += t.batchSize {
+		end := start + t.batchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		batch := missing[start:end]
+		embedded, err := field.Embedder.Embed(batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(embedded) != len(batch) {
+			return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(embedded), len(batch))
+		}
+		for i, vector := range embedded {
+			if err := field.check(vector); err != nil {
+				return nil, err
+			}
+			if t.cache != nil {
+				t.cache.put(field.VectorField, batch[i], vector)
+			}
+			for _, pos := range pending[batch[i]] {
+				vectors[pos] = vector
+			}
+		}
+	}
+	return vectors, nil
+}
+
+// check validates the type and the dimension of the vector against the field
+func (f *embeddingField) check(vector Vector) error {
+	switch v := vector.(type) {
+	case FloatVector:
+		if f.fieldType != FieldTypeFloatVector {
+			return fmt.Errorf("field '%s' of type %s could not hold FloatVector", f.VectorField, f.fieldType)
+		}
+		if f.dimension > 0 && uint32(len(v)) != f.dimension {
+			return fmt.Errorf("embedding of dimension %d does not match the dimension %d of field '%s'",
+				len(v), f.dimension, f.VectorField)
+		}
+	case SparseFloatVector:
+		if f.fieldType != FieldTypeSparseVector {
+			return fmt.Errorf("field '%s' of type %s could not hold SparseFloatVector", f.VectorField, f.fieldType)
+		}
+	default:
+		return fmt.Errorf("unsupported embedding %T for field '%s'", vector, f.VectorField)
+	}
+	return nil
+}
+
+// embeddingCache is a LRU cache of the embeddings by vector field and text
+type embeddingCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List
+}
+
+type embeddingCacheEntry struct {
+	key    string
+	vector Vector
+}
+
+func newEmbeddingCache(capacity int) *embeddingCache {
+	return &embeddingCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element, capacity),
+		lru:      list.New(),
+	}
+}
+
+func (c *embeddingCache) get(field, text string) (Vector, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[field+"\x00"+text]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*embeddingCacheEntry).vector, true
+}
+
+func (c *embeddingCache) put(field, text string, vector Vector) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := field + "\x00" + text
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*embeddingCacheEntry).vector = vector
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&embeddingCacheEntry{key: key, vector: vector})
+	if c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*embeddingCacheEntry).key)
+	}
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// explain.go - explain the scores of hybrid and multivector searches leg by leg
+
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// ExplainSearchArgs explains a HybridSearchRequest or a MultivectorSearchRequest. Besides the
+// fused search, each leg (the vector and BM25 requests of a hybrid search, each request added
+// by AddSingleVectorSearchRequest) is searched alone with the limit, filter, partition key,
+// projections and read consistency of the fused request. LegLimit overrides the limit of the
+// legs to look deeper into them.
+type ExplainSearchArgs struct {
+	Database string
+	Table    string
+	Request  searchRequest
+	LegLimit uint32
+}
+
+// SearchLeg is one leg of an explained search
+type SearchLeg struct {
+	Name    string // "vector" or "bm25" for a hybrid search, "vector[i]" for a multivector search
+	Request searchRequest
+	Rows    []RowResult
+}
+
+// ExplainedRow is a row of the fused search together with its rank, distance and score in each
+// leg, in the order of the legs. The contribution of a leg follows the RRFRank k or the
+// WeightedRank weights of the request, LegScore sums them up.
+type ExplainedRow struct {
+	RowResult
+	Legs     []FusionMatch
+	LegScore float64
+}
+
+// ExplainSearchResult holds the fused rows with their explanation and the rows of each leg.
+// Rank is the fusion policy used to compute the contributions, the weights of a hybrid search
+// are the vector and BM25 weights of the request.
+type ExplainSearchResult struct {
+	Rows []ExplainedRow
+	Legs []SearchLeg
+	Rank fusionRankPolicy
+}
+
+func ExplainSearch(cli client.Client, args *ExplainSearchArgs) (*ExplainSearchResult, error) {
+	legs, rank, err := SplitFusionRequest(args.Request)
+	if err != nil {
+		return nil, err
+	}
+	if args.LegLimit > 0 {
+		for i := range legs {
+			if legs[i].Request, err = withSearchLimit(legs[i].Request, args.LegLimit); err != nil {
+				return nil, err
+			}
+		}
+	}
+	keyFields, _, err := describeKeyFields(cli, args.Database, args.Table)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyFields) == 0 {
+		return nil, fmt.Errorf("no primary key in table '%s'", args.Table)
+	}
+	fused, addedFields, err := withSearchProjections(args.Request, keyFields)
+	if err != nil {
+		return nil, err
+	}
+	_, needRelevance := rank.(*WeightedRank)
+
+	// the fused search and the legs are searched concurrently
+	var fusedRows []RowResult
+	var fusedErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fusedRows, fusedErr = searchRows(cli, args.Database, args.Table, fused)
+	}()
+	runs, err := runLegs(cli, args.Database, args.Table, legs, keyFields, needRelevance)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if fusedErr != nil {
+		return nil, fusedErr
+	}
+
+	hits, keys, err := fuseRuns(runs, rank, false)
+	if err != nil {
+		return nil, err
+	}
+	explained := make(map[string]*FusionHit, len(hits))
+	for i := range hits {
+		explained[keys[i]] = &hits[i]
+	}
+	result := &ExplainSearchResult{
+		Rows: make([]ExplainedRow, 0, len(fusedRows)),
+		Legs: legs,
+		Rank: rank,
+	}
+	for i, run := range runs {
+		removeFields(run.rows, run.addedFields)
+		result.Legs[i].Rows = run.rows
+	}
+	for _, row := range fusedRows {
+		explainedRow := ExplainedRow{RowResult: row, Legs: make([]FusionMatch, len(legs))}
+		if hit, ok := explained[PrimaryKeyString(pickFields(row.Row, keyFields))]; ok {
+			explainedRow.Legs = hit.Matches
+			explainedRow.LegScore = hit.Score
+		}
+		result.Rows = append(result.Rows, explainedRow)
+	}
+	removeFields(fusedRows, addedFields)
+	return result, nil
+}
+
+// SplitFusionRequest returns the legs of a HybridSearchRequest or a MultivectorSearchRequest,
+// each inheriting the common fields of the request, together with the fusion policy of the
+// request. A multivector search without rank is fused by RRFRank with DefaultRRFK.
+func SplitFusionRequest(request searchRequest) ([]SearchLeg, fusionRankPolicy, error) {
+	switch r := request.(type) {
+	case *HybridSearchRequest:
+		if r.vectorRequest == nil || r.bm25Request == nil {
+			return nil, nil, fmt.Errorf("hybrid search request should have both vector and BM25 requests")
+		}
+		vectorLeg, err := inheritCommonFields(r.vectorRequest, &r.searchCommonFields)
+		if err != nil {
+			return nil, nil, err
+		}
+		bm25Leg, err := inheritCommonFields(r.bm25Request, &r.searchCommonFields)
+		if err != nil {
+			return nil, nil, err
+		}
+		legs := []SearchLeg{
+			{Name: "vector", Request: vectorLeg},
+			{Name: "bm25", Request: bm25Leg},
+		}
+		rank := WeightedRank{}.New([]float64{exactFloat64(r.vectorWeight), exactFloat64(r.bm25Weight)})
+		return legs, rank, nil
+	case *MultivectorSearchRequest:
+		if len(r.vectorRequests) == 0 {
+			return nil, nil, fmt.Errorf("multivector search request should have vector requests")
+		}
+		legs := make([]SearchLeg, 0, len(r.vectorRequests))
+		for i, vectorRequest := range r.vectorRequests {
+			leg, err := inheritCommonFields(vectorRequest, &r.searchCommonFields)
+			if err != nil {
+				return nil, nil, err
+			}
+			legs = append(legs, SearchLeg{Name: fmt.Sprintf("vector[%d]", i), Request: leg})
+		}
+		var rank fusionRankPolicy = r.ranking
+		if rank == nil {
+			rank = RRFRank{}.New(DefaultRRFK)
+		}
+		return legs, rank, nil
+	}
+	return nil, nil, fmt.Errorf("only hybrid and multivector search requests could be split, got %T", request)
+}
+
+// runLegs searches the legs concurrently
+func runLegs(cli client.Client, database, table string, legs []SearchLeg, keyFields []string,
+	needRelevance bool) ([]*fusionRun, error) {
+	runs := make([]*fusionRun, len(legs))
+	errs := make([]error, len(legs))
+	var wg sync.WaitGroup
+	for i := range legs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			query := &FusionSubQuery{
+				Client:   cli,
+				Database: database,
+				Table:    table,
+				Request:  legs[i].Request,
+			}
+			runs[i], errs[i] = runFusionSubQuery(query, keyFields, needRelevance)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("leg '%s' failed: %v", legs[i].Name, err)
+		}
+	}
+	return runs, nil
+}
+
+// inheritCommonFields returns a copy of the leg overridden by the common fields of the parent
+func inheritCommonFields(leg searchRequest, parent *searchCommonFields) (searchRequest, error) {
+	if leg.isBatch() {
+		return nil, fmt.Errorf("batch search request is not supported as a leg")
+	}
+	c, err := cloneSearchRequest(leg)
+	if err != nil {
+		return nil, err
+	}
+	fields := commonFieldsOf(c)
+	if parent.isMarked("partitionKey") {
+		fields.mark("partitionKey")
+		fields.partitionKey = parent.partitionKey
+	}
+	if parent.isMarked("projections") {
+		fields.mark("projections")
+		fields.projections = parent.projections
+	}
+	if parent.isMarked("readConsistency") {
+		fields.mark("readConsistency")
+		fields.readConsistency = parent.readConsistency
+	}
+	if parent.isMarked("limit") {
+		fields.mark("limit")
+		fields.limit = parent.limit
+	}
+	if parent.isMarked("filter") {
+		fields.mark("filter")
+		fields.filter = parent.filter
+	}
+	return c, nil
+}
+
+// exactFloat64 converts the weight keeping its shortest decimal form, e.g. 0.4 instead of
+// 0.4000000059604645
+func exactFloat64(f float32) float64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+	return v
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// facet.go - facet counts computed over the rows returned by a search
+
+package api
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// FacetRange is the bucket [Min, Max) of a numeric facet, use math.Inf for an unbounded side
+type FacetRange struct {
+	Label    string // defaults to "[Min, Max)"
+	Min, Max float64
+}
+
+// FacetSpec defines the facet of one field. The values are counted one by one unless Ranges is
+// set, elements of array fields are counted separately. SubFacets are computed within each bucket.
+type FacetSpec struct {
+	Field     string
+	Ranges    []FacetRange
+	Size      int // max number of buckets by value returned, 0 means all
+	SubFacets []FacetSpec
+}
+
+type FacetBucket struct {
+	Value     interface{} // the field value, or the label of the range
+	Count     int
+	SubFacets []Facet
+}
+
+// Facet lists the buckets of a field, buckets by value are ordered by descending count and
+// buckets by range are in the order of FacetSpec.Ranges
+type Facet struct {
+	Field   string
+	Buckets []FacetBucket
+	Missing int // number of rows without a value for the field
+}
+
+// ComputeFacetsArgs computes the facets over the rows returned by a search. When
+// FetchMissingFields is set, the facet fields not projected in the rows are fetched with
+// BatchQueryRow, which requires the primary key fields to be projected.
+type ComputeFacetsArgs struct {
+	Database           string
+	Table              string
+	Rows               []RowResult
+	Facets             []FacetSpec
+	FetchMissingFields bool
+	ReadConsistency    ReadConsistency
+}
+
+// FacetResult returns the facet tree alongside the rows it is computed from
+type FacetResult struct {
+	Rows   []RowResult
+	Facets []Facet
+}
+
+// ComputeFacets computes the facets over the rows of the args
+func ComputeFacets(cli client.Client, args *ComputeFacetsArgs) (*FacetResult, error) {
+	values := make([]map[string]interface{}, len(args.Rows))
+	for i, row := range args.Rows {
+		values[i] = row.Row.Fields
+	}
+	if args.FetchMissingFields {
+		var err error
+		values, err = fetchFacetFields(cli, args, values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &FacetResult{
+		Rows:   args.Rows,
+		Facets: facetsOf(values, args.Facets),
+	}, nil
+}
+
+func facetFields(specs []FacetSpec, fields map[string]bool) {
+	for _, spec := range specs {
+		fields[spec.Field] = true
+		facetFields(spec.SubFacets, fields)
+	}
+}
+
+// fetchFacetFields completes the field values of the rows with the facet fields not projected
+func fetchFacetFields(cli client.Client, args *ComputeFacetsArgs,
+	values []map[string]interface{}) ([]map[string]interface{}, error) {
+	fields := make(map[string]bool)
+	facetFields(args.Facets, fields)
+	missing := make([]string, 0)
+	for field := range fields {
+		for _, v := range values {
+			if _, ok := v[field]; !ok {
+				missing = append(missing, field)
+				break
+			}
+		}
+	}
+	if len(missing) == 0 || len(values) == 0 {
+		return values, nil
+	}
+	sort.Strings(missing)
+
+	primaryKeys, partitionKeys, err := describeKeyFields(cli, args.Database, args.Table)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]QueryKey, len(values))
+	for i, v := range values {
+		for _, field := range primaryKeys {
+			if _, ok := v[field]; !ok {
+				return nil, fmt.Errorf("primary key field '%s' should be projected to fetch facet fields", field)
+			}
+		}
+		keys[i] = rowQueryKey(Row{Fields: v}, primaryKeys, partitionKeys)
+	}
+	projections, _ := appendProjections(primaryKeys, missing)
+	fetched, err := BatchQueryRowByKeys(cli, &BatchQueryRowArgs{
+		Database:        args.Database,
+		Table:           args.Table,
+		Keys:            keys,
+		Projections:     projections,
+		ReadConsistency: args.ReadConsistency,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make([]map[string]interface{}, len(values))
+	for i, v := range values {
+		merged[i] = make(map[string]interface{}, len(v)+len(missing))
+		for field, value := range v {
+			merged[i][field] = value
+		}
+		if row := fetched.Rows[i]; row != nil {
+			for _, field := range missing {
+				if value, ok := row.Fields[field]; ok {
+					merged[i][field] = value
+				}
+			}
+		}
+	}
+	return merged, nil
+}
+
+func facetsOf(values []map[string]interface{}, specs []FacetSpec) []Facet {
+	facets := make([]Facet, 0, len(specs))
+	for _, spec := range specs {
+		if len(spec.Ranges) > 0 {
+			facets = append(facets, rangeFacetOf(values, spec))
+		} else {
+			facets = append(facets, valueFacetOf(values, spec))
+		}
+	}
+	return facets
+}
+
+// facetValues returns the values of the field, one per element for array fields
+func facetValues(v map[string]interface{}, field string) []interface{} {
+	value, ok := v[field]
+	if !ok || value == nil {
+		return nil
+	}
+	if elements, ok := value.([]interface{}); ok {
+		return elements
+	}
+	return []interface{}{value}
+}
+
+func valueFacetOf(values []map[string]interface{}, spec FacetSpec) Facet {
+	facet := Facet{Field: spec.Field, Buckets: make([]FacetBucket, 0)}
+	keys := make([]string, 0)
+	bucketValues := make(map[string]interface{})
+	bucketRows := make(map[string][]map[string]interface{})
+	for _, v := range values {
+		elements := facetValues(v, spec.Field)
+		if len(elements) == 0 {
+			facet.Missing++
+			continue
+		}
+		counted := make(map[string]bool, len(elements))
+		for _, element := range elements {
+			key := canonicalValue(element)
+			if counted[key] {
+				continue
+			}
+			counted[key] = true
+			if _, ok := bucketValues[key]; !ok {
+				keys = append(keys, key)
+				bucketValues[key] = element
+			}
+			bucketRows[key] = append(bucketRows[key], v)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if len(bucketRows[keys[i]]) != len(bucketRows[keys[j]]) {
+			return len(bucketRows[keys[i]]) > len(bucketRows[keys[j]])
+		}
+		return keys[i] < keys[j]
+	})
+	if spec.Size > 0 && len(keys) > spec.Size {
+		keys = keys[:spec.Size]
+	}
+	for _, key := range keys {
+		bucket := FacetBucket{Value: bucketValues[key], Count: len(bucketRows[key])}
+		if len(spec.SubFacets) > 0 {
+			bucket.SubFacets = facetsOf(bucketRows[key], spec.SubFacets)
+		}
+		facet.Buckets = append(facet.Buckets, bucket)
+	}
+	return facet
+}
+
+func rangeFacetOf(values []map[string]interface{}, spec FacetSpec) Facet {
+	facet := Facet{Field: spec.Field, Buckets: make([]FacetBucket, 0, len(spec.Ranges))}
+	bucketRows := make([][]map[string]interface{}, len(spec.Ranges))
+	for _, v := range values {
+		elements := facetValues(v, spec.Field)
+		numbers := make([]float64, 0, len(elements))
+		for _, element := range elements {
+			if num, ok := toFloat64(element); ok {
+				numbers = append(numbers, num)
+			}
+		}
+		if len(numbers) == 0 {
+			facet.Missing++
+			continue
+		}
+		for i, r := range spec.Ranges {
+			for _, num := range numbers {
+				if num >= r.Min && num < r.Max {
+					bucketRows[i] = append(bucketRows[i], v)
+					break
+				}
+			}
+		}
+	}
+	for i, r := range spec.Ranges {
+		label := r.Label
+		if len(label) == 0 {
+			label = fmt.Sprintf("[%v, %v)", r.Min, r.Max)
+		}
+		bucket := FacetBucket{Value: label, Count: len(bucketRows[i])}
+		if len(spec.SubFacets) > 0 {
+			bucket.SubFacets = facetsOf(bucketRows[i], spec.SubFacets)
+		}
+		facet.Buckets = append(facet.Buckets, bucket)
+	}
+	return facet
+}
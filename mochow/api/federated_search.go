@@ -0,0 +1,272 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// federated_search.go - search the same request over several tables and clusters
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// MaxFederatedTargetsInFlight bounds the targets searched at once, including the ones which
+// exceeded their timeout but whose requests are still running
+const MaxFederatedTargetsInFlight = 256
+
+var federatedSlots = make(chan struct{}, MaxFederatedTargetsInFlight)
+
+// FederatedTarget is a table searched by FederatedSearch. Name identifies the target in the
+// hits and defaults to "database.table", Client defaults to the client of the federated search
+// and Timeout to the timeout of the federated search.
+type FederatedTarget struct {
+	Name     string
+	Client   client.Client
+	Database string
+	Table    string
+	Timeout  time.Duration
+}
+
+// FederatedSearchArgs sends Request to all the targets concurrently and merges the top Limit
+// rows, Limit defaults to the limit of the request. Rows of vector searches are merged by
+// distance in the direction of MetricType, which defaults to the metric of the vector index
+// of the targets, other rows are merged by score. A target whose metric is unknown fails and
+// the targets answering should agree on the metric.
+//
+// A target failing or exceeding its timeout fails the search, unless AcceptPartialSuccess is
+// set and the ratio of the succeeded targets is not less than SuccessRateLowerBound. The requests
+// of a target exceeding its timeout could not be cancelled and run until the request timeout of
+// its client, so at most MaxFederatedTargetsInFlight targets are searched at once by all the
+// federated searches, a target waiting for its turn within its timeout.
+type FederatedSearchArgs struct {
+	Targets               []FederatedTarget
+	Request               searchRequest // any search request but VectorBatchSearchRequest
+	MetricType            MetricType
+	Timeout               time.Duration
+	Limit                 int
+	AcceptPartialSuccess  bool
+	SuccessRateLowerBound float32
+}
+
+// FederatedHit is a row annotated with the target it comes from
+type FederatedHit struct {
+	RowResult
+	Source   string
+	Database string
+	Table    string
+}
+
+// FederatedTargetFailure records the error of a target
+type FederatedTargetFailure struct {
+	Source string
+	Err    error
+}
+
+type FederatedSearchResult struct {
+	Hits     []FederatedHit
+	Failures []FederatedTargetFailure
+}
+
+// FederatedSearchError is returned when the failed targets are not accepted, the failures are
+// listed in the result returned together with it
+type FederatedSearchError struct {
+	Failed int
+	Total  int
+	First  error
+}
+
+func (e *FederatedSearchError) Error() string {
+	return fmt.Sprintf("%d of %d targets failed, first error: %v", e.Failed, e.Total, e.First)
+}
+
+type federatedAnswer struct {
+	index  int
+	rows   []RowResult
+	metric MetricType
+	err    error
+}
+
+func FederatedSearch(cli client.Client, args *FederatedSearchArgs) (*FederatedSearchResult, error) {
+	if len(args.Targets) == 0 {
+		return nil, fmt.Errorf("targets should not be empty")
+	}
+	if args.Request == nil {
+		return nil, fmt.Errorf("request should not be nil")
+	}
+	if args.Request.isBatch() {
+		return nil, fmt.Errorf("batch search request is not supported by federated search")
+	}
+	if args.SuccessRateLowerBound < 0 || args.SuccessRateLowerBound > 1 {
+		return nil, fmt.Errorf("success rate lower bound should be in [0, 1]")
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = int(searchLimit(args.Request))
+	}
+	targets := make([]FederatedTarget, len(args.Targets))
+	for i, target := range args.Targets {
+		if target.Client == nil {
+			target.Client = cli
+		}
+		if len(target.Name) == 0 {
+			target.Name = target.Database + "." + target.Table
+		}
+		if target.Timeout <= 0 {
+			target.Timeout = args.Timeout
+		}
+		targets[i] = target
+	}
+
+	vectorField := ""
+	switch r := args.Request.(type) {
+	case *VectorTopkSearchRequest:
+		vectorField = r.vectorField
+	case *VectorRangeSearchRequest:
+		vectorField = r.vectorField
+	}
+	answers := make(chan federatedAnswer, len(targets))
+	for i := range targets {
+		go searchFederatedTarget(i, &targets[i], args.Request, vectorField, args.MetricType, answers)
+	}
+	rows := make([][]RowResult, len(targets))
+	result := &FederatedSearchResult{
+		Hits:     make([]FederatedHit, 0),
+		Failures: make([]FederatedTargetFailure, 0),
+	}
+	metrics := make([]MetricType, len(targets))
+	for range targets {
+		answer := <-answers
+		if answer.err != nil {
+			result.Failures = append(result.Failures, FederatedTargetFailure{
+				Source: targets[answer.index].Name,
+				Err:    answer.err,
+			})
+			continue
+		}
+		rows[answer.index] = answer.rows
+		metrics[answer.index] = answer.metric
+	}
+	sort.SliceStable(result.Failures, func(i, j int) bool {
+		return result.Failures[i].Source < result.Failures[j].Source
+	})
+
+	if len(result.Failures) > 0 {
+		err := &FederatedSearchError{
+			Failed: len(result.Failures),
+			Total:  len(targets),
+			First:  result.Failures[0].Err,
+		}
+		succeeded := len(targets) - len(result.Failures)
+		if !args.AcceptPartialSuccess || succeeded == 0 ||
+			float32(succeeded) < args.SuccessRateLowerBound*float32(len(targets)) {
+			return result, err
+		}
+	}
+
+	for i, targetRows := range rows {
+		for _, row := range targetRows {
+			result.Hits = append(result.Hits, FederatedHit{
+				RowResult: row,
+				Source:    targets[i].Name,
+				Database:  targets[i].Database,
+				Table:     targets[i].Table,
+			})
+		}
+	}
+	less, err := federatedOrder(vectorField, targets, metrics)
+	if err != nil {
+		return result, err
+	}
+	sort.SliceStable(result.Hits, func(i, j int) bool {
+		return less(&result.Hits[i].RowResult, &result.Hits[j].RowResult)
+	})
+	if limit > 0 && len(result.Hits) > limit {
+		result.Hits = result.Hits[:limit]
+	}
+	return result, nil
+}
+
+// searchFederatedTarget searches the target and sends the answer along with the metric of the
+// vector field, if any. A target exceeding its timeout is answered with an error while its
+// requests are left running, holding their slot until they end.
+func searchFederatedTarget(index int, target *FederatedTarget, request searchRequest, vectorField string,
+	metric MetricType, answers chan<- federatedAnswer) {
+	var timeout <-chan time.Time
+	if target.Timeout > 0 {
+		timer := time.NewTimer(target.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	timedOut := federatedAnswer{index: index, err: fmt.Errorf("timed out after %v", target.Timeout)}
+	select {
+	case federatedSlots <- struct{}{}:
+	case <-timeout:
+		answers <- timedOut
+		return
+	}
+	done := make(chan federatedAnswer, 1)
+	go func() {
+		defer func() { <-federatedSlots }()
+		rows, err := searchRows(target.Client, target.Database, target.Table, request)
+		if err != nil || len(vectorField) == 0 || len(metric) > 0 {
+			done <- federatedAnswer{index: index, rows: rows, metric: metric, err: err}
+			return
+		}
+		info, err := describeVectorField(target.Client, target.Database, target.Table, vectorField)
+		if err == nil && len(info.metricType) == 0 {
+			err = fmt.Errorf("metric type of field '%s' is unknown, it should be given", vectorField)
+		}
+		if err != nil {
+			done <- federatedAnswer{index: index, err: err}
+			return
+		}
+		done <- federatedAnswer{index: index, rows: rows, metric: info.metricType}
+	}()
+	select {
+	case answer := <-done:
+		answers <- answer
+	case <-timeout:
+		answers <- timedOut
+	}
+}
+
+// federatedOrder returns the order merging the rows, better rows first. The metrics of the
+// targets which failed are empty.
+func federatedOrder(vectorField string, targets []FederatedTarget,
+	metrics []MetricType) (func(a, b *RowResult) bool, error) {
+	if len(vectorField) == 0 {
+		return func(a, b *RowResult) bool {
+			return a.Score > b.Score
+		}, nil
+	}
+	var metric MetricType
+	first := -1
+	for i := range targets {
+		if len(metrics[i]) == 0 {
+			continue
+		}
+		if first < 0 {
+			metric, first = metrics[i], i
+		} else if metrics[i] != metric {
+			return nil, fmt.Errorf("metric type %s of target '%s' differs from %s of target '%s', it should be given",
+				metrics[i], targets[i].Name, metric, targets[first].Name)
+		}
+	}
+	return func(a, b *RowResult) bool {
+		return DistanceToScore(metric, a.Distance) > DistanceToScore(metric, b.Distance)
+	}, nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// fusion_candidates.go - cache the rows of the legs of a fused search to fuse them offline
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// FusionCandidatesArgs collects the candidates of a HybridSearchRequest or a
+// MultivectorSearchRequest, the legs are split as ExplainSearch does and LegLimit overrides
+// their limit to collect more candidates
+type FusionCandidatesArgs struct {
+	Database string
+	Table    string
+	Request  searchRequest
+	LegLimit uint32
+}
+
+// FusionCandidates holds the rows of the legs of a fused search, searched once, so that they
+// are fused offline by any rank policy, e.g. to tune the fusion parameters. The rows are
+// identified by the strings of their primary keys built by PrimaryKeyString.
+type FusionCandidates struct {
+	Legs []SearchLeg
+	Rank fusionRankPolicy // the rank policy of the request
+	runs []*fusionRun
+}
+
+func CollectFusionCandidates(cli client.Client, args *FusionCandidatesArgs) (*FusionCandidates, error) {
+	legs, rank, err := SplitFusionRequest(args.Request)
+	if err != nil {
+		return nil, err
+	}
+	if args.LegLimit > 0 {
+		for i := range legs {
+			if legs[i].Request, err = withSearchLimit(legs[i].Request, args.LegLimit); err != nil {
+				return nil, err
+			}
+		}
+	}
+	keyFields, _, err := describeKeyFields(cli, args.Database, args.Table)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyFields) == 0 {
+		return nil, fmt.Errorf("no primary key in table '%s'", args.Table)
+	}
+	runs, err := runLegs(cli, args.Database, args.Table, legs, keyFields, true)
+	if err != nil {
+		return nil, err
+	}
+	for i, run := range runs {
+		removeFields(run.rows, run.addedFields)
+		run.addedFields = nil
+		legs[i].Rows = run.rows
+	}
+	return &FusionCandidates{Legs: legs, Rank: rank, runs: runs}, nil
+}
+
+// Fuse fuses the candidates by the rank policy as FusionSearch does and returns the keys of the
+// top limit rows, all of them if limit is not positive. A nil rank is the rank of the request.
+func (c *FusionCandidates) Fuse(rank fusionRankPolicy, normalize bool, limit int) ([]string, error) {
+	if rank == nil {
+		rank = c.Rank
+	}
+	_, keys, err := fuseRuns(c.runs, rank, normalize)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
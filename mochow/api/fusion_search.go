@@ -0,0 +1,314 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// fusion_search.go - run independent searches and fuse their results on the client side
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// DefaultRRFK is the k of the reciprocal rank fusion if RRFRank is built with a non-positive k
+const DefaultRRFK = 60
+
+// FusionSubQuery is one search fused by FusionSearch. Client defaults to the client of the
+// fusion search. MetricType gives the direction of the distances of a vector search, it
+// defaults to the metric of the vector index of the field.
+type FusionSubQuery struct {
+	Client     client.Client
+	Database   string
+	Table      string
+	Request    searchRequest // any search request but VectorBatchSearchRequest
+	MetricType MetricType
+}
+
+// FusionSearchArgs runs the sub queries in parallel and fuses their results by Rank:
+//   - RRFRank sums 1 / (k + rank) over the sub queries hitting a row
+//   - WeightedRank sums weight * relevance, with one weight per sub query
+//
+// The relevance is the score of the row, or the distance turned into a similarity for vector
+// searches. NormalizeScores min-max normalizes the relevance of each sub query into [0, 1]
+// before weighting it. Rows are de-duplicated by the values of KeyFields, which default to
+// the primary key of the tables. Limit defaults to the largest limit of the sub queries.
+type FusionSearchArgs struct {
+	SubQueries      []FusionSubQuery
+	Rank            fusionRankPolicy // RRFRank by default
+	NormalizeScores bool
+	KeyFields       []string
+	Limit           int
+}
+
+// FusionMatch describes a fused row within one sub query
+type FusionMatch struct {
+	Rank         int // 1-based rank in the sub query, 0 if the row is not hit
+	Distance     float64
+	Score        float64
+	Contribution float64 // the part of the fused score coming from the sub query
+}
+
+// FusionHit is a fused row, Matches has one entry per sub query in their order
+type FusionHit struct {
+	Row     Row
+	Score   float64
+	Matches []FusionMatch
+}
+
+type FusionSearchResult struct {
+	Hits []FusionHit
+}
+
+// fusionRun holds the rows returned by a sub query
+type fusionRun struct {
+	rows          []RowResult
+	keys          []string
+	distanceBased bool
+	metricType    MetricType
+	addedFields   []string
+}
+
+func FusionSearch(cli client.Client, args *FusionSearchArgs) (*FusionSearchResult, error) {
+	if len(args.SubQueries) == 0 {
+		return nil, fmt.Errorf("sub queries should not be empty")
+	}
+	limit := args.Limit
+	for _, query := range args.SubQueries {
+		if query.Request == nil {
+			return nil, fmt.Errorf("request of sub query should not be nil")
+		}
+		if query.Request.isBatch() {
+			return nil, fmt.Errorf("batch search request is not supported by fusion search")
+		}
+		if args.Limit <= 0 && int(searchLimit(query.Request)) > limit {
+			limit = int(searchLimit(query.Request))
+		}
+	}
+	rank := args.Rank
+	if rank == nil {
+		rank = RRFRank{}.New(DefaultRRFK)
+	}
+	_, needRelevance := rank.(*WeightedRank)
+
+	runs := make([]*fusionRun, len(args.SubQueries))
+	errs := make([]error, len(args.SubQueries))
+	var wg sync.WaitGroup
+	for i := range args.SubQueries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			query := args.SubQueries[i]
+			if query.Client == nil {
+				query.Client = cli
+			}
+			runs[i], errs[i] = runFusionSubQuery(&query, args.KeyFields, needRelevance)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("sub query %d failed: %v", i, err)
+		}
+	}
+
+	hits, _, err := fuseRuns(runs, rank, args.NormalizeScores)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return &FusionSearchResult{Hits: hits}, nil
+}
+
+// runFusionSubQuery searches the sub query, projecting the key fields to de-duplicate the rows
+func runFusionSubQuery(query *FusionSubQuery, keyFields []string, needRelevance bool) (*fusionRun, error) {
+	run := &fusionRun{}
+	if len(keyFields) == 0 {
+		primaryKeys, _, err := describeKeyFields(query.Client, query.Database, query.Table)
+		if err != nil {
+			return nil, err
+		}
+		keyFields = primaryKeys
+	}
+	if len(keyFields) == 0 {
+		return nil, fmt.Errorf("no key field to de-duplicate the rows of table '%s'", query.Table)
+	}
+
+	vectorField := ""
+	switch r := query.Request.(type) {
+	case *VectorTopkSearchRequest:
+		vectorField = r.vectorField
+	case *VectorRangeSearchRequest:
+		vectorField = r.vectorField
+	}
+	if len(vectorField) > 0 {
+		run.distanceBased = true
+		run.metricType = query.MetricType
+		if len(run.metricType) == 0 && needRelevance {
+			info, err := describeVectorField(query.Client, query.Database, query.Table, vectorField)
+			if err != nil {
+				return nil, err
+			}
+			run.metricType = info.metricType
+		}
+		if len(run.metricType) == 0 && needRelevance {
+			return nil, fmt.Errorf("metric type of field '%s' is unknown, it should be given", vectorField)
+		}
+	}
+
+	request, added, err := withSearchProjections(query.Request, keyFields)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := searchRows(query.Client, query.Database, query.Table, request)
+	if err != nil {
+		return nil, err
+	}
+	run.rows = rows
+	run.addedFields = added
+	run.keys = make([]string, len(rows))
+	for i, row := range rows {
+		run.keys[i] = PrimaryKeyString(pickFields(row.Row, keyFields))
+	}
+	return run, nil
+}
+
+// relevance returns the relevance of the i-th row of the run, larger is better
+func (run *fusionRun) relevance(i int) float64 {
+	if run.distanceBased {
+		return DistanceToScore(run.metricType, run.rows[i].Distance)
+	}
+	return run.rows[i].Score
+}
+
+// fuseRuns merges the rows of the runs by key and sorts them by the fused score, the keys of the
+// hits are returned in the same order
+func fuseRuns(runs []*fusionRun, rank fusionRankPolicy, normalize bool) ([]FusionHit, []string, error) {
+	var contribution func(run int, pos int) float64
+	switch r := rank.(type) {
+	case *RRFRank:
+		k := r.k
+		if k <= 0 {
+			k = DefaultRRFK
+		}
+		contribution = func(_ int, pos int) float64 {
+			return 1 / float64(k+int64(pos)+1)
+		}
+	case *WeightedRank:
+		if len(r.weights) != len(runs) {
+			return nil, nil, fmt.Errorf("%d weights are given for %d sub queries", len(r.weights), len(runs))
+		}
+		relevance := make([][]float64, len(runs))
+		for i, run := range runs {
+			relevance[i] = make([]float64, len(run.rows))
+			for pos := range run.rows {
+				relevance[i][pos] = run.relevance(pos)
+			}
+			if normalize {
+				minMaxNormalize(relevance[i])
+			}
+		}
+		contribution = func(run int, pos int) float64 {
+			return r.weights[run] * relevance[run][pos]
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported fusion rank policy %T", rank)
+	}
+
+	hits := make([]FusionHit, 0)
+	keys := make([]string, 0)
+	positions := make(map[string]int)
+	for i, run := range runs {
+		for pos, row := range run.rows {
+			key := run.keys[pos]
+			hitPos, ok := positions[key]
+			if !ok {
+				hitPos = len(hits)
+				positions[key] = hitPos
+				keys = append(keys, key)
+				hits = append(hits, FusionHit{
+					Row:     Row{Fields: make(map[string]interface{}, len(row.Row.Fields))},
+					Matches: make([]FusionMatch, len(runs)),
+				})
+			}
+			hit := &hits[hitPos]
+			if hit.Matches[i].Rank > 0 {
+				continue // duplicated row within the sub query, the best one is kept
+			}
+			for field, value := range row.Row.Fields {
+				if _, ok := hit.Row.Fields[field]; !ok && !containsField(run.addedFields, field) {
+					hit.Row.Fields[field] = value
+				}
+			}
+			c := contribution(i, pos)
+			hit.Matches[i] = FusionMatch{
+				Rank:         pos + 1,
+				Distance:     row.Distance,
+				Score:        row.Score,
+				Contribution: c,
+			}
+			hit.Score += c
+		}
+	}
+	order := make([]int, len(hits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return hits[order[i]].Score > hits[order[j]].Score
+	})
+	sortedHits := make([]FusionHit, len(hits))
+	sortedKeys := make([]string, len(hits))
+	for i, pos := range order {
+		sortedHits[i] = hits[pos]
+		sortedKeys[i] = keys[pos]
+	}
+	return sortedHits, sortedKeys, nil
+}
+
+// minMaxNormalize scales the values into [0, 1], equal values are all scaled to 1
+func minMaxNormalize(values []float64) {
+	if len(values) == 0 {
+		return
+	}
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+	for i, v := range values {
+		if hi == lo {
+			values[i] = 1
+		} else {
+			values[i] = (v - lo) / (hi - lo)
+		}
+	}
+}
+
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
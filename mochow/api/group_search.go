@@ -0,0 +1,149 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// group_search.go - group or collapse the search results by the value of a field
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// DefaultGroupSearchMaxLimit bounds the limit used to over-fetch the rows of a group search
+const DefaultGroupSearchMaxLimit = 1000
+
+// GroupSearchArgs searches for GroupCount distinct values of GroupField, keeping the top
+// GroupSize rows of each value. GroupSize 1 collapses the results to one row per value.
+// The search is repeated with a doubled limit until enough groups are found with GroupSize rows
+// each, the doubled limit adds no row to the first GroupCount groups, the rows are exhausted or
+// MaxLimit is reached.
+type GroupSearchArgs struct {
+	Database   string
+	Table      string
+	Request    searchRequest // VectorTopkSearchRequest, VectorRangeSearchRequest, BM25SearchRequest, HybridSearchRequest or MultivectorSearchRequest
+	GroupField string
+	GroupCount int
+	GroupSize  int
+	MaxLimit   uint32
+}
+
+// SearchGroup holds the top rows of one value of the group field, rows without the field
+// are grouped together with a nil value
+type SearchGroup struct {
+	Value interface{}
+	Rows  []RowResult
+}
+
+// GroupSearchResult lists the groups in the order of their best row
+type GroupSearchResult struct {
+	Groups []SearchGroup
+}
+
+func GroupSearch(cli client.Client, args *GroupSearchArgs) (*GroupSearchResult, error) {
+	if len(args.GroupField) == 0 {
+		return nil, fmt.Errorf("group field should not be empty")
+	}
+	if args.GroupCount <= 0 {
+		return nil, fmt.Errorf("group count should be positive")
+	}
+	if args.Request.isBatch() {
+		return nil, fmt.Errorf("batch search request is not supported by group search")
+	}
+	groupSize := args.GroupSize
+	if groupSize <= 0 {
+		groupSize = 1
+	}
+	maxLimit := args.MaxLimit
+	if maxLimit == 0 {
+		maxLimit = DefaultGroupSearchMaxLimit
+	}
+	request, addedProjections, err := withSearchProjections(args.Request, []string{args.GroupField})
+	if err != nil {
+		return nil, err
+	}
+
+	limit := uint32(args.GroupCount * groupSize)
+	if original := searchLimit(args.Request); original > limit {
+		limit = original
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	previous := -1
+	for {
+		limitedRequest, err := withSearchLimit(request, limit)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := searchRows(cli, args.Database, args.Table, limitedRequest)
+		if err != nil {
+			return nil, err
+		}
+		groups := groupRows(rows, args.GroupField, groupSize)
+		top := topGroupRows(groups, args.GroupCount)
+		// the documents often have fewer matching rows than the group size, so the search stops
+		// as well once more rows do not add to the first groups
+		done := top == args.GroupCount*groupSize || (top >= 0 && top == previous)
+		if done || uint32(len(rows)) < limit || limit >= maxLimit {
+			if len(groups) > args.GroupCount {
+				groups = groups[:args.GroupCount]
+			}
+			for _, group := range groups {
+				removeFields(group.Rows, addedProjections)
+			}
+			return &GroupSearchResult{Groups: groups}, nil
+		}
+		previous = top
+		limit *= 2
+		if limit > maxLimit {
+			limit = maxLimit
+		}
+	}
+}
+
+// topGroupRows returns the number of rows held by the first count groups, -1 if fewer groups are
+// found. The groups are ranked by their best row, so fetching more rows could not change the
+// first groups but only add rows to them.
+func topGroupRows(groups []SearchGroup, count int) int {
+	if len(groups) < count {
+		return -1
+	}
+	rows := 0
+	for _, group := range groups[:count] {
+		rows += len(group.Rows)
+	}
+	return rows
+}
+
+// groupRows groups the rows by the value of the field, keeping the first rows of each group
+func groupRows(rows []RowResult, field string, groupSize int) []SearchGroup {
+	groups := make([]SearchGroup, 0)
+	positions := make(map[string]int)
+	for _, row := range rows {
+		value := row.Row.Fields[field]
+		key := canonicalValue(value)
+		pos, ok := positions[key]
+		if !ok {
+			pos = len(groups)
+			positions[key] = pos
+			groups = append(groups, SearchGroup{Value: value, Rows: make([]RowResult, 0, groupSize)})
+		}
+		if len(groups[pos].Rows) < groupSize {
+			groups[pos].Rows = append(groups[pos].Rows, row)
+		}
+	}
+	return groups
+}
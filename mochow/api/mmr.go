@@ -0,0 +1,163 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// mmr.go - maximal marginal relevance reranking of vector search results
+
+package api
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+const (
+	// DefaultMMRFetchFactor is the over-fetch factor used when MMRSearchArgs.FetchLimit is not set
+	DefaultMMRFetchFactor = 4
+	// DefaultMMRLambda is the lambda used when MMRSearchArgs.Lambda is not set
+	DefaultMMRLambda = 0.5
+)
+
+// MMRSearchArgs selects 'Request.limit' rows among FetchLimit candidates of the request. Each
+// step selects the candidate maximizing
+//
+//	Lambda * sim(query, candidate) - (1 - Lambda) * max(sim(candidate, selected))
+//
+// so Lambda 1 keeps the original order and Lambda 0 maximizes the diversity, Lambda defaults to
+// DefaultMMRLambda. The similarity follows MetricType, which defaults to the metric of the
+// vector index of the field.
+type MMRSearchArgs struct {
+	Database   string
+	Table      string
+	Request    *VectorTopkSearchRequest
+	FetchLimit uint32
+	Lambda     *float64
+	MetricType MetricType
+}
+
+// MMRSearch searches the candidates with their vectors and reranks them by maximal marginal
+// relevance, the distances returned by the service are kept in the rows
+func MMRSearch(cli client.Client, args *MMRSearchArgs) ([]RowResult, error) {
+	if args.Request == nil {
+		return nil, fmt.Errorf("request should not be nil")
+	}
+	lambda := float64(DefaultMMRLambda)
+	if args.Lambda != nil {
+		lambda = *args.Lambda
+	}
+	if lambda < 0 || lambda > 1 {
+		return nil, fmt.Errorf("lambda should be in [0, 1]")
+	}
+	query, ok := args.Request.vector.(FloatVector)
+	if !ok {
+		return nil, fmt.Errorf("MMR search only supports FloatVector")
+	}
+	k := int(args.Request.limit)
+	fetchLimit := args.FetchLimit
+	if fetchLimit == 0 {
+		fetchLimit = args.Request.limit * DefaultMMRFetchFactor
+	}
+	if fetchLimit < args.Request.limit {
+		return nil, fmt.Errorf("fetch limit should not be less than the limit of request")
+	}
+
+	vectorField := args.Request.vectorField
+	info, err := describeVectorField(cli, args.Database, args.Table, vectorField)
+	if err != nil {
+		return nil, err
+	}
+	metric := args.MetricType
+	if len(metric) == 0 {
+		metric = info.metricType
+	}
+	request, vectorAdded, err := withVectorProjection(args.Request, vectorField, info.tableFields)
+	if err != nil {
+		return nil, err
+	}
+	if request, err = withSearchLimit(request, fetchLimit); err != nil {
+		return nil, err
+	}
+	candidates, err := searchRows(cli, args.Database, args.Table, request)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make([]FloatVector, len(candidates))
+	for i, candidate := range candidates {
+		if vectors[i], err = RowFloatVector(candidate.Row, vectorField); err != nil {
+			return nil, err
+		}
+	}
+	relevance, err := BatchDistance(metric, query, vectors)
+	if err != nil {
+		return nil, err
+	}
+	for i := range relevance {
+		relevance[i] = DistanceToScore(metric, relevance[i])
+	}
+
+	selected, err := selectMMR(metric, vectors, relevance, k, lambda)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]RowResult, 0, len(selected))
+	for _, i := range selected {
+		rows = append(rows, candidates[i])
+	}
+	if vectorAdded {
+		removeFields(rows, []string{vectorField})
+	}
+	return rows, nil
+}
+
+// selectMMR greedily selects k candidates by maximal marginal relevance
+func selectMMR(metric MetricType, vectors []FloatVector, relevance []float64, k int, lambda float64) ([]int, error) {
+	if k > len(vectors) {
+		k = len(vectors)
+	}
+	selected := make([]int, 0, k)
+	chosen := make([]bool, len(vectors))
+	maxSimilarity := make([]float64, len(vectors))
+	for i := range maxSimilarity {
+		maxSimilarity[i] = math.Inf(-1)
+	}
+	for len(selected) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range vectors {
+			if chosen[i] {
+				continue
+			}
+			score := lambda * relevance[i]
+			if len(selected) > 0 {
+				score -= (1 - lambda) * maxSimilarity[i]
+			}
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		chosen[best] = true
+		selected = append(selected, best)
+		distances, err := BatchDistance(metric, vectors[best], vectors)
+		if err != nil {
+			return nil, err
+		}
+		for i, distance := range distances {
+			if similarity := DistanceToScore(metric, distance); !chosen[i] && similarity > maxSimilarity[i] {
+				maxSimilarity[i] = similarity
+			}
+		}
+	}
+	return selected, nil
+}
@@ -192,6 +192,8 @@ type VectorSearchArgs struct {
 	Database string
 	Table    string
 	Request  vectorSearchRequest
+	Rerank   *RerankOptions  // optional second stage reranking
+	Rescore  *RescoreOptions // optional exact re-scoring, could not be combined with Rerank
 }
 
 // BM25 search
@@ -199,6 +201,7 @@ type BM25SearchArgs struct {
 	Database string
 	Table    string
 	Request  bm25SearchRequest
+	Rerank   *RerankOptions // optional second stage reranking
 }
 
 // hybrid search (vector + BM25)
@@ -206,6 +209,7 @@ type HybridSearchArgs struct {
 	Database string
 	Table    string
 	Request  hybridSearchRequest
+	Rerank   *RerankOptions // optional second stage reranking
 }
 
 // multi vector search (vector + BM25)
@@ -213,6 +217,7 @@ type MultivectorSearchArgs struct {
 	Database string
 	Table    string
 	Request  vectorSearchRequest
+	Rerank   *RerankOptions // optional second stage reranking
 }
 
 // search iterator
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// rerank.go - second stage reranking of the search results
+
+package api
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// DefaultRerankOverFetchFactor is used when RerankOptions.OverFetchFactor is not set
+const DefaultRerankOverFetchFactor = 3
+
+// Reranker re-scores the candidate rows of a search for the query. The returned rows carry the
+// new score in 'Score', their order does not matter.
+type Reranker interface {
+	Rerank(query string, candidates []RowResult) ([]RowResult, error)
+}
+
+// RerankOptions plugs a reranker into a search. The search fetches OverFetchFactor times the
+// limit of the request, the candidates are reranked and the TopN rows with a score not less
+// than ScoreThreshold are returned. TopN defaults to the limit of the request.
+type RerankOptions struct {
+	Reranker        Reranker
+	Query           string
+	OverFetchFactor uint32
+	TopN            uint32
+	ScoreThreshold  *float64
+}
+
+func rerankSearch(cli client.Client, database, table string, request searchRequest,
+	options *RerankOptions) (*SearchResult, error) {
+	if options.Reranker == nil {
+		return nil, fmt.Errorf("reranker should not be nil")
+	}
+	if request.isBatch() {
+		return nil, fmt.Errorf("batch search request is not supported by reranking")
+	}
+	factor := options.OverFetchFactor
+	if factor == 0 {
+		factor = DefaultRerankOverFetchFactor
+	}
+	limit := searchLimit(request)
+	topN := options.TopN
+	if topN == 0 {
+		topN = limit
+	}
+	if limit > 0 {
+		var err error
+		if request, err = withSearchLimit(request, limit*factor); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := search(cli, database, table, request)
+	if err != nil {
+		return nil, err
+	}
+	if result.Rows == nil || len(result.Rows.Rows) == 0 {
+		return result, nil
+	}
+	rows, err := options.Reranker.Rerank(options.Query, result.Rows.Rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Score > rows[j].Score
+	})
+	if options.ScoreThreshold != nil {
+		kept := rows[:0]
+		for _, row := range rows {
+			if row.Score >= *options.ScoreThreshold {
+				kept = append(kept, row)
+			}
+		}
+		rows = kept
+	}
+	if topN > 0 && uint32(len(rows)) > topN {
+		rows = rows[:topN]
+	}
+	result.Rows.Rows = rows
+	return result, nil
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// rescore.go - recompute the exact distances of approximate vector search results
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// DefaultRescoreOverFetchFactor is used when RescoreOptions.OverFetchFactor is not set
+const DefaultRescoreOverFetchFactor = 4
+
+// RescoreOptions makes a topk search fetch OverFetchFactor times the limit of the request,
+// recompute the exact distances from the stored vectors and return the closest rows with the
+// exact distances, as needed by quantized indexes such as HNSWPQ and PUCK. The vectors are
+// retrieved by projecting the vector field, or by a following BatchQueryRow when
+// FetchByBatchQuery is set. MetricType defaults to the metric of the vector index of the field.
+type RescoreOptions struct {
+	OverFetchFactor   uint32
+	FetchByBatchQuery bool
+	MetricType        MetricType
+}
+
+func rescoreSearch(cli client.Client, database, table string, request vectorSearchRequest,
+	options *RescoreOptions) (*SearchResult, error) {
+	topk, ok := request.(*VectorTopkSearchRequest)
+	if !ok {
+		return nil, fmt.Errorf("rescoring only supports VectorTopkSearchRequest")
+	}
+	query, ok := topk.vector.(FloatVector)
+	if !ok {
+		return nil, fmt.Errorf("rescoring only supports FloatVector")
+	}
+	return rescoreTopk(cli, database, table, topk, topk.vectorField, query, options)
+}
+
+// rescoreTopk searches the over-fetched rows of the topk request and sorts them by the exact
+// distances from the query to the float vectors of the vector field, the request may search
+// another field such as a quantized copy of the vector field
+func rescoreTopk(cli client.Client, database, table string, topk *VectorTopkSearchRequest, vectorField string,
+	query FloatVector, options *RescoreOptions) (*SearchResult, error) {
+	factor := options.OverFetchFactor
+	if factor == 0 {
+		factor = DefaultRescoreOverFetchFactor
+	}
+	info, err := describeVectorField(cli, database, table, vectorField)
+	if err != nil {
+		return nil, err
+	}
+	metric := options.MetricType
+	if len(metric) == 0 {
+		metric = info.metricType
+	}
+	if len(metric) == 0 {
+		return nil, fmt.Errorf("metric type of field '%s' is unknown, it should be given", vectorField)
+	}
+
+	var fetched searchRequest
+	var addedFields []string
+	var primaryKeys, partitionKeys []string
+	if options.FetchByBatchQuery {
+		if primaryKeys, partitionKeys, err = describeKeyFields(cli, database, table); err != nil {
+			return nil, err
+		}
+		// the partition key is only required when it is not a part of the primary key
+		projections, _ := appendProjections(primaryKeys, partitionKeys)
+		if fetched, addedFields, err = withSearchProjections(topk, projections); err != nil {
+			return nil, err
+		}
+	} else {
+		var vectorAdded bool
+		if fetched, vectorAdded, err = withVectorProjection(topk, vectorField, info.tableFields); err != nil {
+			return nil, err
+		}
+		if vectorAdded {
+			addedFields = []string{vectorField}
+		}
+	}
+	if fetched, err = withSearchLimit(fetched, topk.limit*factor); err != nil {
+		return nil, err
+	}
+	result, err := search(cli, database, table, fetched)
+	if err != nil {
+		return nil, err
+	}
+	if result.Rows == nil || len(result.Rows.Rows) == 0 {
+		return result, nil
+	}
+	rows := result.Rows.Rows
+
+	vectors := make([]FloatVector, len(rows))
+	if options.FetchByBatchQuery {
+		keys := make([]QueryKey, len(rows))
+		for i, row := range rows {
+			keys[i] = rowQueryKey(row.Row, primaryKeys, partitionKeys)
+		}
+		stored, err := BatchQueryRowByKeys(cli, &BatchQueryRowArgs{
+			Database:       database,
+			Table:          table,
+			Keys:           keys,
+			Projections:    []string{vectorField},
+			RetrieveVector: true,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			row, ok := stored.Get(keys[i].PrimaryKey)
+			if !ok {
+				return nil, fmt.Errorf("row %s is not found", PrimaryKeyString(keys[i].PrimaryKey))
+			}
+			if vectors[i], err = RowFloatVector(*row, vectorField); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for i, row := range rows {
+			if vectors[i], err = RowFloatVector(row.Row, vectorField); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	distances, err := BatchDistance(metric, query, vectors)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Distance = distances[i]
+	}
+	SortByDistance(metric, rows)
+	if uint32(len(rows)) > topk.limit {
+		rows = rows[:topk.limit]
+	}
+	removeFields(rows, addedFields)
+	result.Rows.Rows = rows
+	return result, nil
+}
@@ -17,6 +17,8 @@
 package api
 
 import (
+	"fmt"
+
 	"github.com/bytedance/sonic"
 
 	"github.com/baidu/mochow-sdk-go/v2/client"
@@ -170,23 +172,45 @@ func BatchQueryRow(cli client.Client, args *BatchQueryRowArgs) (*BatchQueryRowRe
 	return result, nil
 }
 
+// VectorSearch searches the vectors. As every search, a VectorTopkSearchRequest gets the
+// parameters of the tuned config of its table and field which it does not set if the client is
+// a TunedSearchConfigSource.
 func VectorSearch(cli client.Client, args *VectorSearchArgs) (*SearchResult, error) {
+	if args.Rescore != nil {
+		if args.Rerank != nil {
+			return nil, fmt.Errorf("rescoring could not be combined with reranking")
+		}
+		return rescoreSearch(cli, args.Database, args.Table, args.Request, args.Rescore)
+	}
+	if args.Rerank != nil {
+		return rerankSearch(cli, args.Database, args.Table, args.Request, args.Rerank)
+	}
 	return search(cli, args.Database, args.Table, args.Request)
 }
 
 func BM25Search(cli client.Client, args *BM25SearchArgs) (*SearchResult, error) {
+	if args.Rerank != nil {
+		return rerankSearch(cli, args.Database, args.Table, args.Request, args.Rerank)
+	}
 	return search(cli, args.Database, args.Table, args.Request)
 }
 
 func HybridSearch(cli client.Client, args *HybridSearchArgs) (*SearchResult, error) {
+	if args.Rerank != nil {
+		return rerankSearch(cli, args.Database, args.Table, args.Request, args.Rerank)
+	}
 	return search(cli, args.Database, args.Table, args.Request)
 }
 
 func MultiVectorSearch(cli client.Client, args *MultivectorSearchArgs) (*SearchResult, error) {
+	if args.Rerank != nil {
+		return rerankSearch(cli, args.Database, args.Table, args.Request, args.Rerank)
+	}
 	return search(cli, args.Database, args.Table, args.Request)
 }
 
 func search(cli client.Client, database string, table string, request searchRequest) (*SearchResult, error) {
+	request = applyTunedSearchConfig(cli, database, table, request)
 	args := request.toDict()
 	args["database"] = database
 	args["table"] = table
@@ -0,0 +1,246 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// row_bulk.go - bulk mutations built on top of the single row APIs
+
+package api
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+const (
+	DefaultBulkBatchSize   = 100
+	DefaultBulkParallelism = 4
+)
+
+// BulkProgressFunc is called after each batch of a bulk mutation, total is -1 when unknown
+type BulkProgressFunc func(done, total int)
+
+// BulkDeleteRowArgs deletes the rows of the keys, BatchSize keys are deleted between two
+// progress reports and Parallelism delete requests run concurrently
+type BulkDeleteRowArgs struct {
+	Database    string
+	Table       string
+	Keys        []QueryKey
+	BatchSize   int
+	Parallelism int
+	Progress    BulkProgressFunc
+}
+
+// UpdateRowByFilterArgs applies the update to every row matching the filter. The rows are
+// scanned BatchSize rows at a time and Parallelism update requests run concurrently.
+// Nothing is updated in DryRun mode, only the matched rows are counted.
+type UpdateRowByFilterArgs struct {
+	Database        string
+	Table           string
+	Filter          string
+	Update          map[string]interface{}
+	ReadConsistency ReadConsistency
+	BatchSize       int
+	Parallelism     int
+	DryRun          bool
+	Progress        BulkProgressFunc
+}
+
+// RowFailure describes a row which failed to be mutated
+type RowFailure struct {
+	PrimaryKey   map[string]interface{}
+	PartitionKey map[string]interface{}
+	Err          error
+}
+
+// BulkMutationResult is the summary report of a bulk mutation
+type BulkMutationResult struct {
+	Matched   int // number of keys given or rows matching the filter
+	Succeeded int
+	DryRun    bool
+	Failures  []RowFailure
+}
+
+// BulkMutationError is returned when some rows of a bulk mutation failed, the failed rows are
+// listed in the result returned together with it
+type BulkMutationError struct {
+	Failed int
+	Total  int
+	First  error
+}
+
+func (e *BulkMutationError) Error() string {
+	return fmt.Sprintf("%d of %d rows failed, first error: %v", e.Failed, e.Total, e.First)
+}
+
+// bulkRunner executes the mutation of the keys concurrently and collects the report
+type bulkRunner struct {
+	parallelism int
+	progress    BulkProgressFunc
+	mutate      func(key QueryKey) error
+
+	mu     sync.Mutex
+	done   int
+	result BulkMutationResult
+}
+
+func newBulkRunner(parallelism int, progress BulkProgressFunc, mutate func(key QueryKey) error) *bulkRunner {
+	if parallelism <= 0 {
+		parallelism = DefaultBulkParallelism
+	}
+	return &bulkRunner{
+		parallelism: parallelism,
+		progress:    progress,
+		mutate:      mutate,
+		result:      BulkMutationResult{Failures: make([]RowFailure, 0)},
+	}
+}
+
+func (b *bulkRunner) run(keys []QueryKey, total int) {
+	b.mu.Lock()
+	b.result.Matched += len(keys)
+	b.mu.Unlock()
+
+	sem := make(chan struct{}, b.parallelism)
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key QueryKey) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := b.mutate(key)
+
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if err != nil {
+				b.result.Failures = append(b.result.Failures, RowFailure{
+					PrimaryKey:   key.PrimaryKey,
+					PartitionKey: key.PartitionKey,
+					Err:          err,
+				})
+			} else {
+				b.result.Succeeded++
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	if b.progress != nil {
+		b.done += len(keys)
+		b.progress(b.done, total)
+	}
+}
+
+func (b *bulkRunner) report() (*BulkMutationResult, error) {
+	result := b.result
+	if len(result.Failures) > 0 {
+		return &result, &BulkMutationError{
+			Failed: len(result.Failures),
+			Total:  result.Matched,
+			First:  result.Failures[0].Err,
+		}
+	}
+	return &result, nil
+}
+
+// BulkDeleteRow deletes the rows of all the keys. When some of the rows failed to be deleted,
+// a *BulkMutationError is returned together with the report listing the failures.
+func BulkDeleteRow(cli client.Client, args *BulkDeleteRowArgs) (*BulkMutationResult, error) {
+	batchSize := args.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBulkBatchSize
+	}
+	runner := newBulkRunner(args.Parallelism, args.Progress, func(key QueryKey) error {
+		return DeleteRow(cli, &DeleteRowArgs{
+			Database:     args.Database,
+			Table:        args.Table,
+			PrimaryKey:   key.PrimaryKey,
+			PartitionKey: key.PartitionKey,
+		})
+	})
+	for offset := 0; offset < len(args.Keys); offset += batchSize {
+		end := offset + batchSize
+		if end > len(args.Keys) {
+			end = len(args.Keys)
+		}
+		runner.run(args.Keys[offset:end], len(args.Keys))
+	}
+	return runner.report()
+}
+
+// UpdateRowByFilter applies the update to every row matching the filter. The primary keys of the
+// matched rows are scanned with SelectRow and each row is updated with UpdateRow. If the scan
+// failed, its error is returned together with the report of the rows scanned before, whose
+// updates are all done, otherwise the error follows the same rules as BulkDeleteRow.
+func UpdateRowByFilter(cli client.Client, args *UpdateRowByFilterArgs) (*BulkMutationResult, error) {
+	if len(args.Filter) == 0 {
+		return nil, fmt.Errorf("filter should not be empty")
+	}
+	if len(args.Update) == 0 && !args.DryRun {
+		return nil, fmt.Errorf("update should not be empty")
+	}
+	primaryKeys, partitionKeys, err := describeKeyFields(cli, args.Database, args.Table)
+	if err != nil {
+		return nil, err
+	}
+	// the partition key is only required when it is not a part of the primary key
+	projections, _ := appendProjections(primaryKeys, partitionKeys)
+
+	runner := newBulkRunner(args.Parallelism, args.Progress, func(key QueryKey) error {
+		if args.DryRun {
+			return nil
+		}
+		return UpdateRow(cli, &UpdateRowArgs{
+			Database:     args.Database,
+			Table:        args.Table,
+			PrimaryKey:   key.PrimaryKey,
+			PartitionKey: key.PartitionKey,
+			Update:       args.Update,
+		})
+	})
+	runner.result.DryRun = args.DryRun
+
+	batchSize := args.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultSelectBatchSize
+	}
+	iterator := NewSelectIterator(cli, &SelectRowArgs{
+		Database:        args.Database,
+		Table:           args.Table,
+		Filter:          args.Filter,
+		Limit:           uint64(batchSize),
+		Projections:     projections,
+		ReadConsistency: args.ReadConsistency,
+	})
+	defer iterator.Close()
+	for {
+		rows, err := iterator.Next()
+		if err != nil {
+			result, _ := runner.report()
+			return result, err
+		}
+		if rows == nil {
+			break
+		}
+		keys := make([]QueryKey, 0, len(rows))
+		for _, row := range rows {
+			keys = append(keys, rowQueryKey(row, primaryKeys, partitionKeys))
+		}
+		runner.run(keys, -1)
+	}
+	return runner.report()
+}
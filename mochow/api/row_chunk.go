@@ -0,0 +1,406 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// row_chunk.go - split oversized row requests into chunks and aggregate the chunk results
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// ChunkOptions controls how InsertRow, UpsertRow and BatchQueryRow requests are split
+type ChunkOptions struct {
+	// MaxRowsPerRequest is the max number of rows or keys sent in one request, 0 means no limit
+	MaxRowsPerRequest int
+	// MaxBytesPerRequest is the max size of the encoded JSON body of one request, 0 means no limit.
+	// A single row larger than the limit is still sent alone.
+	MaxBytesPerRequest int
+	// Parallelism is the max number of chunks executed concurrently, less than 2 means sequential
+	Parallelism int
+}
+
+// ChunkFailure describes one chunk of a split request which failed
+type ChunkFailure struct {
+	Index  int        // index of the chunk
+	Offset int        // position of the first row or key of the chunk in the request
+	Count  int        // number of rows or keys in the chunk
+	Rows   []Row      // rows of the chunk, set for InsertRow and UpsertRow
+	Keys   []QueryKey // keys of the chunk, set for BatchQueryRow
+	Err    error
+}
+
+// PartialFailureError is returned when some chunks of a split request failed. The result returned
+// together with it aggregates the chunks which succeeded.
+type PartialFailureError struct {
+	TotalChunks int
+	Failures    []ChunkFailure
+}
+
+func (e *PartialFailureError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%d of %d chunks failed:", len(e.Failures), e.TotalChunks))
+	for _, f := range e.Failures {
+		sb.WriteString(fmt.Sprintf(" [chunk %d, rows %d-%d", f.Index, f.Offset, f.Offset+f.Count-1))
+		if len(f.Keys) > 0 {
+			sb.WriteString(", keys")
+			for _, key := range f.Keys {
+				sb.WriteString(" {")
+				sb.WriteString(PrimaryKeyString(key.PrimaryKey))
+				sb.WriteString("}")
+			}
+		}
+		sb.WriteString(fmt.Sprintf(": %v]", f.Err))
+	}
+	return sb.String()
+}
+
+// FailedRows returns the rows which failed to be inserted or upserted, in the request order
+func (e *PartialFailureError) FailedRows() []Row {
+	rows := make([]Row, 0)
+	for _, f := range e.Failures {
+		rows = append(rows, f.Rows...)
+	}
+	return rows
+}
+
+// FailedKeys returns the keys which failed to be queried, in the request order
+func (e *PartialFailureError) FailedKeys() []QueryKey {
+	keys := make([]QueryKey, 0)
+	for _, f := range e.Failures {
+		keys = append(keys, f.Keys...)
+	}
+	return keys
+}
+
+// FailedOffsets returns the positions in the request of all the rows or keys which failed
+func (e *PartialFailureError) FailedOffsets() []int {
+	offsets := make([]int, 0)
+	for _, f := range e.Failures {
+		for i := 0; i < f.Count; i++ {
+			offsets = append(offsets, f.Offset+i)
+		}
+	}
+	return offsets
+}
+
+type chunkRange struct {
+	offset int
+	count  int
+}
+
+// splitChunks splits n items into chunks, sizeOf returns the encoded size of the i-th item
+func splitChunks(n int, envelope int, sizeOf func(i int) (int, error), opts *ChunkOptions) ([]chunkRange, error) {
+	chunks := make([]chunkRange, 0)
+	current := chunkRange{}
+	currentBytes := envelope
+	for i := 0; i < n; i++ {
+		itemBytes := 0
+		if opts.MaxBytesPerRequest > 0 {
+			size, err := sizeOf(i)
+			if err != nil {
+				return nil, err
+			}
+			itemBytes = size + 1 // separator
+		}
+		full := opts.MaxRowsPerRequest > 0 && current.count >= opts.MaxRowsPerRequest
+		if opts.MaxBytesPerRequest > 0 && current.count > 0 && currentBytes+itemBytes > opts.MaxBytesPerRequest {
+			full = true
+		}
+		if full {
+			chunks = append(chunks, current)
+			current = chunkRange{offset: i}
+			currentBytes = envelope
+		}
+		current.count++
+		currentBytes += itemBytes
+	}
+	if current.count > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks, nil
+}
+
+// runChunks executes fn for every chunk and collects the failures in chunk order
+func runChunks(chunks []chunkRange, parallelism int, fn func(index int, chunk chunkRange) error) []ChunkFailure {
+	errs := make([]error, len(chunks))
+	if parallelism < 2 {
+		for i, chunk := range chunks {
+			errs[i] = fn(i, chunk)
+		}
+	} else {
+		sem := make(chan struct{}, parallelism)
+		var wg sync.WaitGroup
+		for i, chunk := range chunks {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, chunk chunkRange) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				errs[i] = fn(i, chunk)
+			}(i, chunk)
+		}
+		wg.Wait()
+	}
+
+	failures := make([]ChunkFailure, 0)
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, ChunkFailure{
+				Index:  i,
+				Offset: chunks[i].offset,
+				Count:  chunks[i].count,
+				Err:    err,
+			})
+		}
+	}
+	return failures
+}
+
+func splitRows(args *InsertRowArgs, opts *ChunkOptions) ([]chunkRange, error) {
+	envelope := 0
+	if opts.MaxBytesPerRequest > 0 {
+		jsonBytes, err := sonic.Marshal(&InsertRowArgs{Database: args.Database, Table: args.Table})
+		if err != nil {
+			return nil, err
+		}
+		envelope = len(jsonBytes) + len(`"rows":[]`)
+	}
+	return splitChunks(len(args.Rows), envelope, func(i int) (int, error) {
+		jsonBytes, err := sonic.Marshal(&args.Rows[i])
+		return len(jsonBytes), err
+	}, opts)
+}
+
+func chunkedWriteRow(args *InsertRowArgs, opts *ChunkOptions,
+	write func(args *InsertRowArgs) (uint64, error)) (*InsertRowResult, error) {
+	chunks, err := splitRows(args, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) <= 1 {
+		affectedCount, err := write(args)
+		if err != nil {
+			return nil, err
+		}
+		return &InsertRowResult{AffectedCount: affectedCount}, nil
+	}
+
+	affectedCounts := make([]uint64, len(chunks))
+	failures := runChunks(chunks, opts.Parallelism, func(index int, chunk chunkRange) error {
+		chunkArgs := &InsertRowArgs{
+			Database: args.Database,
+			Table:    args.Table,
+			Rows:     args.Rows[chunk.offset : chunk.offset+chunk.count],
+		}
+		affectedCount, err := write(chunkArgs)
+		affectedCounts[index] = affectedCount
+		return err
+	})
+
+	result := &InsertRowResult{}
+	for _, affectedCount := range affectedCounts {
+		result.AffectedCount += affectedCount
+	}
+	for i := range failures {
+		failures[i].Rows = args.Rows[failures[i].Offset : failures[i].Offset+failures[i].Count]
+	}
+	if len(failures) > 0 {
+		return result, &PartialFailureError{TotalChunks: len(chunks), Failures: failures}
+	}
+	return result, nil
+}
+
+// ChunkedInsertRow inserts the rows with as many requests as the options require.
+// When some of the requests failed, the returned error is a *PartialFailureError and the
+// result holds the affected count of the requests which succeeded.
+func ChunkedInsertRow(cli client.Client, args *InsertRowArgs, opts *ChunkOptions) (*InsertRowResult, error) {
+	if opts == nil {
+		return InsertRow(cli, args)
+	}
+	return chunkedWriteRow(args, opts, func(chunkArgs *InsertRowArgs) (uint64, error) {
+		result, err := InsertRow(cli, chunkArgs)
+		if err != nil {
+			return 0, err
+		}
+		return result.AffectedCount, nil
+	})
+}
+
+// ChunkedUpsertRow upserts the rows with as many requests as the options require.
+// The returned error follows the same rules as ChunkedInsertRow.
+func ChunkedUpsertRow(cli client.Client, args *UpsertRowArg, opts *ChunkOptions) (*UpsertRowResult, error) {
+	if opts == nil {
+		return UpsertRow(cli, args)
+	}
+	result, err := chunkedWriteRow((*InsertRowArgs)(args), opts, func(chunkArgs *InsertRowArgs) (uint64, error) {
+		result, err := UpsertRow(cli, (*UpsertRowArg)(chunkArgs))
+		if err != nil {
+			return 0, err
+		}
+		return result.AffectedCount, nil
+	})
+	return (*UpsertRowResult)(result), err
+}
+
+// ChunkedBatchQueryRow queries the keys with as many requests as the options require. The rows of
+// the result are ordered as the keys of the request. When some of the requests failed, the returned
+// error is a *PartialFailureError and the result holds the rows of the requests which succeeded.
+func ChunkedBatchQueryRow(cli client.Client, args *BatchQueryRowArgs, opts *ChunkOptions) (*BatchQueryRowResult, error) {
+	if opts == nil {
+		return BatchQueryRow(cli, args)
+	}
+
+	envelope := 0
+	if opts.MaxBytesPerRequest > 0 {
+		envelopeArgs := *args
+		envelopeArgs.Keys = nil
+		jsonBytes, err := sonic.Marshal(&envelopeArgs)
+		if err != nil {
+			return nil, err
+		}
+		envelope = len(jsonBytes) + len(`"keys":[]`)
+	}
+	chunks, err := splitChunks(len(args.Keys), envelope, func(i int) (int, error) {
+		jsonBytes, err := sonic.Marshal(&args.Keys[i])
+		return len(jsonBytes), err
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	// primary key fields are needed in the rows to restore the order of the keys
+	keyFields := primaryKeyFields(args.Keys)
+	queryArgs, addedProjections := withProjections(args, keyFields)
+
+	chunkRows := make([][]Row, len(chunks))
+	failures := runChunks(chunks, opts.Parallelism, func(index int, chunk chunkRange) error {
+		chunkArgs := *queryArgs
+		chunkArgs.Keys = args.Keys[chunk.offset : chunk.offset+chunk.count]
+		result, err := BatchQueryRow(cli, &chunkArgs)
+		if err != nil {
+			return err
+		}
+		chunkRows[index] = result.Row
+		return nil
+	})
+	if len(chunks) <= 1 && len(failures) > 0 {
+		return nil, failures[0].Err
+	}
+	for i := range failures {
+		failures[i].Keys = args.Keys[failures[i].Offset : failures[i].Offset+failures[i].Count]
+	}
+
+	rows := make([]Row, 0, len(args.Keys))
+	for _, r := range chunkRows {
+		rows = append(rows, r...)
+	}
+	orderRowsByKeys(rows, args.Keys, keyFields)
+	for _, row := range rows {
+		for _, field := range addedProjections {
+			delete(row.Fields, field)
+		}
+	}
+
+	result := &BatchQueryRowResult{Row: rows}
+	if len(failures) > 0 {
+		return result, &PartialFailureError{TotalChunks: len(chunks), Failures: failures}
+	}
+	return result, nil
+}
+
+// primaryKeyFields returns the sorted names of the primary key fields used by the keys
+func primaryKeyFields(keys []QueryKey) []string {
+	fields := make([]string, 0)
+	if len(keys) == 0 {
+		return fields
+	}
+	for field := range keys[0].PrimaryKey {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// withProjections makes sure the fields are projected, it returns the args to send and the
+// fields which were not requested by the caller
+func withProjections(args *BatchQueryRowArgs, fields []string) (*BatchQueryRowArgs, []string) {
+	if len(args.Projections) == 0 {
+		return args, nil
+	}
+	projections, added := appendProjections(args.Projections, fields)
+	if len(added) == 0 {
+		return args, nil
+	}
+	queryArgs := *args
+	queryArgs.Projections = projections
+	return &queryArgs, added
+}
+
+// appendProjections returns the projections extended with the missing fields and the added fields
+func appendProjections(projections []string, fields []string) ([]string, []string) {
+	projected := make(map[string]bool, len(projections))
+	for _, p := range projections {
+		projected[p] = true
+	}
+	result := append(make([]string, 0, len(projections)+len(fields)), projections...)
+	added := make([]string, 0)
+	for _, field := range fields {
+		if !projected[field] {
+			projected[field] = true
+			result = append(result, field)
+			added = append(added, field)
+		}
+	}
+	return result, added
+}
+
+// orderRowsByKeys sorts the rows as the keys, rows not matching any key are moved to the end
+func orderRowsByKeys(rows []Row, keys []QueryKey, keyFields []string) {
+	positions := make(map[string]int, len(keys))
+	for i, key := range keys {
+		k := rowKeyString(key.PrimaryKey, keyFields)
+		if _, ok := positions[k]; !ok {
+			positions[k] = i
+		}
+	}
+	rowPositions := make([]int, len(rows))
+	for i, row := range rows {
+		if pos, ok := positions[rowKeyString(row.Fields, keyFields)]; ok {
+			rowPositions[i] = pos
+		} else {
+			rowPositions[i] = len(keys)
+		}
+	}
+	indexes := make([]int, len(rows))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return rowPositions[indexes[i]] < rowPositions[indexes[j]]
+	})
+	sorted := make([]Row, len(rows))
+	for i, idx := range indexes {
+		sorted[i] = rows[idx]
+	}
+	copy(rows, sorted)
+}
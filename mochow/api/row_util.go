@@ -0,0 +1,181 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// row_util.go - helpers to identify and compare rows on the client side
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// PrimaryKeyString returns a canonical string for the given primary key, so that keys built by
+// the caller and the ones decoded from the service (as json.Number) compare equal
+func PrimaryKeyString(primaryKey map[string]interface{}) string {
+	fields := make([]string, 0, len(primaryKey))
+	for field := range primaryKey {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return rowKeyString(primaryKey, fields)
+}
+
+// rowKeyString builds the canonical key of the given fields, the fields should be sorted
+func rowKeyString(values map[string]interface{}, fields []string) string {
+	var sb strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(field)
+		sb.WriteByte('=')
+		sb.WriteString(canonicalValue(values[field]))
+	}
+	return sb.String()
+}
+
+func canonicalValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+		if f, err := v.Float64(); err == nil {
+			return canonicalFloat(f)
+		}
+		return v.String()
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float32:
+		return canonicalFloat(float64(v))
+	case float64:
+		return canonicalFloat(v)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// toFloat64 converts a numeric field value to float64
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func canonicalFloat(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// describeKeyFields returns the primary key fields and the partition key fields of the table
+func describeKeyFields(cli client.Client, database, table string) ([]string, []string, error) {
+	result, err := DescTable(cli, &DescTableArgs{Database: database, Table: table})
+	if err != nil {
+		return nil, nil, err
+	}
+	primaryKeys := make([]string, 0)
+	partitionKeys := make([]string, 0)
+	if result.Table == nil || result.Table.Schema == nil {
+		return primaryKeys, partitionKeys, nil
+	}
+	for _, field := range result.Table.Schema.Fields {
+		if field.PrimaryKey {
+			primaryKeys = append(primaryKeys, field.FieldName)
+		}
+		if field.PartitionKey {
+			partitionKeys = append(partitionKeys, field.FieldName)
+		}
+	}
+	return primaryKeys, partitionKeys, nil
+}
+
+// rowQueryKey returns the key of the row, the partition key is only set when some of its fields
+// are not a part of the primary key
+func rowQueryKey(row Row, primaryKeys, partitionKeys []string) QueryKey {
+	key := QueryKey{PrimaryKey: pickFields(row, primaryKeys)}
+	if _, extra := appendProjections(primaryKeys, partitionKeys); len(extra) > 0 {
+		key.PartitionKey = pickFields(row, partitionKeys)
+	}
+	return key
+}
+
+// pickFields returns the values of the given fields of the row
+func pickFields(row Row, fields []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		values[field] = row.Fields[field]
+	}
+	return values
+}
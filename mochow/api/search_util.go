@@ -0,0 +1,220 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// search_util.go - helpers to derive search requests for client side post-processing
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+func copyMarks(set map[string]bool) map[string]bool {
+	marks := make(map[string]bool, len(set))
+	for k, v := range set {
+		marks[k] = v
+	}
+	return marks
+}
+
+// cloneSearchRequest returns a copy of the request which could be modified without touching the
+// original one, the nested requests are shared
+func cloneSearchRequest(request searchRequest) (searchRequest, error) {
+	switch r := request.(type) {
+	case *VectorTopkSearchRequest:
+		c := *r
+		c.set = copyMarks(r.set)
+		return &c, nil
+	case *VectorRangeSearchRequest:
+		c := *r
+		c.set = copyMarks(r.set)
+		return &c, nil
+	case *VectorBatchSearchRequest:
+		c := *r
+		c.set = copyMarks(r.set)
+		return &c, nil
+	case *BM25SearchRequest:
+		c := *r
+		c.set = copyMarks(r.set)
+		return &c, nil
+	case *HybridSearchRequest:
+		c := *r
+		c.set = copyMarks(r.set)
+		return &c, nil
+	case *MultivectorSearchRequest:
+		c := *r
+		c.set = copyMarks(r.set)
+		return &c, nil
+	}
+	return nil, fmt.Errorf("unsupported search request %T", request)
+}
+
+// commonFieldsOf returns the fields shared by all kinds of search requests
+func commonFieldsOf(request searchRequest) *searchCommonFields {
+	switch r := request.(type) {
+	case *VectorTopkSearchRequest:
+		return &r.searchCommonFields
+	case *VectorRangeSearchRequest:
+		return &r.searchCommonFields
+	case *VectorBatchSearchRequest:
+		return &r.searchCommonFields
+	case *BM25SearchRequest:
+		return &r.searchCommonFields
+	case *HybridSearchRequest:
+		return &r.searchCommonFields
+	case *MultivectorSearchRequest:
+		return &r.searchCommonFields
+	}
+	return nil
+}
+
+// searchLimit returns the limit of the request, 0 if not set
+func searchLimit(request searchRequest) uint32 {
+	fields := commonFieldsOf(request)
+	if fields == nil || !fields.isMarked("limit") {
+		return 0
+	}
+	return fields.limit
+}
+
+// withSearchLimit returns a copy of the request with the limit
+func withSearchLimit(request searchRequest, limit uint32) (searchRequest, error) {
+	c, err := cloneSearchRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	fields := commonFieldsOf(c)
+	fields.mark("limit")
+	fields.limit = limit
+	return c, nil
+}
+
+// effectiveProjections returns the projections applied by the request, the ones of the nested
+// requests apply to a hybrid search request without projections
+func effectiveProjections(request searchRequest) ([]string, bool) {
+	fields := commonFieldsOf(request)
+	if fields == nil {
+		return nil, false
+	}
+	if fields.isMarked("projections") {
+		return fields.projections, true
+	}
+	if r, ok := request.(*HybridSearchRequest); ok {
+		if projections, ok := effectiveProjections(r.vectorRequest); ok {
+			return projections, true
+		}
+		return effectiveProjections(r.bm25Request)
+	}
+	return nil, false
+}
+
+// withSearchProjections returns a copy of the request projecting the fields as well, together with
+// the fields which were not projected. Nothing is added if all fields are projected.
+func withSearchProjections(request searchRequest, projections []string) (searchRequest, []string, error) {
+	c, err := cloneSearchRequest(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, ok := effectiveProjections(c)
+	if !ok || len(current) == 0 {
+		return c, nil, nil
+	}
+	fields := commonFieldsOf(c)
+	var added []string
+	fields.mark("projections")
+	fields.projections, added = appendProjections(current, projections)
+	return c, added, nil
+}
+
+// withVectorProjection returns a copy of the request retrieving the vector field, together with
+// whether the field was not projected by the request. When no projection is set, all the fields
+// of the table are projected.
+func withVectorProjection(request searchRequest, vectorField string, tableFields []string) (searchRequest, bool, error) {
+	c, err := cloneSearchRequest(request)
+	if err != nil {
+		return nil, false, err
+	}
+	fields := commonFieldsOf(c)
+	current, ok := effectiveProjections(c)
+	if !ok || len(current) == 0 {
+		fields.mark("projections")
+		fields.projections, _ = appendProjections(tableFields, []string{vectorField})
+		return c, true, nil
+	}
+	var added []string
+	fields.mark("projections")
+	fields.projections, added = appendProjections(current, []string{vectorField})
+	return c, len(added) > 0, nil
+}
+
+// vectorFieldInfo describes a vector field and the fields of its table
+type vectorFieldInfo struct {
+	metricType  MetricType
+	fieldType   FieldType
+	dimension   uint32
+	tableFields []string
+}
+
+// describeVectorField returns the schema of the vector field, the metric type is taken from the
+// vector index built on the field
+func describeVectorField(cli client.Client, database, table, field string) (*vectorFieldInfo, error) {
+	result, err := DescTable(cli, &DescTableArgs{Database: database, Table: table})
+	if err != nil {
+		return nil, err
+	}
+	if result.Table == nil || result.Table.Schema == nil {
+		return nil, fmt.Errorf("schema of table '%s' is not available", table)
+	}
+	info := &vectorFieldInfo{tableFields: make([]string, 0, len(result.Table.Schema.Fields))}
+	found := false
+	for _, f := range result.Table.Schema.Fields {
+		info.tableFields = append(info.tableFields, f.FieldName)
+		if f.FieldName == field {
+			found = true
+			info.fieldType = f.FieldType
+			info.dimension = f.Dimension
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("field '%s' does not exist in table '%s'", field, table)
+	}
+	info.metricType = IndexMetricType(result.Table.Schema, field)
+	return info, nil
+}
+
+// searchRows executes a single search request and returns the rows
+func searchRows(cli client.Client, database, table string, request searchRequest) ([]RowResult, error) {
+	if request.isBatch() {
+		return nil, fmt.Errorf("batch search request is not supported")
+	}
+	result, err := search(cli, database, table, request)
+	if err != nil {
+		return nil, err
+	}
+	if result.Rows == nil {
+		return []RowResult{}, nil
+	}
+	return result.Rows.Rows, nil
+}
+
+// removeFields deletes the fields from the rows
+func removeFields(rows []RowResult, fields []string) {
+	for _, row := range rows {
+		for _, field := range fields {
+			delete(row.Row.Fields, field)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// select_iterator.go - implementation of select iterator for scanning rows by filter
+
+package api
+
+import (
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// DefaultSelectBatchSize is the page size used by SelectIterator when the limit is not set
+const DefaultSelectBatchSize = 1000
+
+// SelectIterator pages through all the rows matching the filter of a select request
+type SelectIterator struct {
+	client   client.Client
+	args     SelectRowArgs
+	finished bool
+}
+
+// NewSelectIterator creates a new SelectIterator, 'args.Limit' is the size of each page and
+// 'args.Marker' is the position to start from
+func NewSelectIterator(cli client.Client, args *SelectRowArgs) *SelectIterator {
+	iterArgs := *args
+	if iterArgs.Limit == 0 {
+		iterArgs.Limit = DefaultSelectBatchSize
+	}
+	return &SelectIterator{
+		client: cli,
+		args:   iterArgs,
+	}
+}
+
+// Next returns the next page of rows
+// Returns nil when the iterator is finished
+func (si *SelectIterator) Next() ([]Row, error) {
+	for !si.finished {
+		result, err := SelectRow(si.client, &si.args)
+		if err != nil {
+			return nil, err
+		}
+		if !result.IsTruncated || len(result.NextMarker) == 0 {
+			si.finished = true
+		}
+		si.args.Marker = result.NextMarker
+		if len(result.Rows) > 0 {
+			return result.Rows, nil
+		}
+	}
+	return nil, nil
+}
+
+// Marker returns the marker of the next page, it could be used to resume the scan
+func (si *SelectIterator) Marker() map[string]interface{} {
+	return si.args.Marker
+}
+
+// Close cleans up any resources used by the iterator
+func (si *SelectIterator) Close() {
+	// No resources to clean up in this implementation
+}
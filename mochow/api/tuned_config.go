@@ -0,0 +1,126 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// tuned_config.go - the persisted search parameters recommended for a vector field
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+)
+
+// TunedSearchConfig holds the search parameters recommended for the topk searches on a vector
+// field of a table, together with the recall measured at K when they were tuned. The zero
+// parameters are not set.
+type TunedSearchConfig struct {
+	Database          string  `json:"database"`
+	Table             string  `json:"table"`
+	VectorField       string  `json:"vectorField"`
+	Ef                uint32  `json:"ef,omitempty"`
+	SearchCoarseCount uint32  `json:"searchCoarseCount,omitempty"`
+	K                 int     `json:"k,omitempty"`
+	TargetRecall      float64 `json:"targetRecall,omitempty"`
+	Recall            float64 `json:"recall,omitempty"`
+}
+
+// TunedSearchConfigSource is implemented by the clients holding tuned configs, e.g.
+// *mochow.Client. The configs are applied to every topk search sent through the client, once
+// the limit is raised by the over-fetching of rescoring, reranking or grouping.
+type TunedSearchConfigSource interface {
+	ApplyTunedSearchConfig(database, table string, request *VectorTopkSearchRequest) *VectorTopkSearchRequest
+}
+
+// applyTunedSearchConfig returns the request with the tuned config of the client if the request
+// is a topk search
+func applyTunedSearchConfig(cli client.Client, database, table string, request searchRequest) searchRequest {
+	source, ok := cli.(TunedSearchConfigSource)
+	if !ok {
+		return request
+	}
+	topk, ok := request.(*VectorTopkSearchRequest)
+	if !ok {
+		return request
+	}
+	return source.ApplyTunedSearchConfig(database, table, topk)
+}
+
+// LoadTunedSearchConfig reads the config written by Save
+func LoadTunedSearchConfig(path string) (*TunedSearchConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tuned := &TunedSearchConfig{}
+	if err := sonic.Unmarshal(data, tuned); err != nil {
+		return nil, err
+	}
+	if len(tuned.Database) == 0 || len(tuned.Table) == 0 || len(tuned.VectorField) == 0 {
+		return nil, fmt.Errorf("database, table and vector field of the tuned config should be set")
+	}
+	return tuned, nil
+}
+
+// Save writes the config as JSON
+func (t *TunedSearchConfig) Save(path string) error {
+	data, err := sonic.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Config returns the VectorSearchConfig setting the tuned parameters
+func (t *TunedSearchConfig) Config() *VectorSearchConfig {
+	config := VectorSearchConfig{}.New()
+	if t.Ef > 0 {
+		config.Ef(t.Ef)
+	}
+	if t.SearchCoarseCount > 0 {
+		config.SearchCoarseCount(t.SearchCoarseCount)
+	}
+	return config
+}
+
+// ApplyTo returns a copy of the request with the tuned parameters, the parameters set by the
+// request are kept and ef is raised to the limit of the request if lower. The request is
+// returned as is if it searches another field.
+func (t *TunedSearchConfig) ApplyTo(request *VectorTopkSearchRequest) *VectorTopkSearchRequest {
+	if request.vectorField != t.VectorField || (t.Ef == 0 && t.SearchCoarseCount == 0) {
+		return request
+	}
+	config := VectorSearchConfig{}.New()
+	if request.isMarked("config") && request.config != nil {
+		for k, v := range request.config.params {
+			config.params[k] = v
+		}
+	}
+	if _, ok := config.params["ef"]; !ok && t.Ef > 0 {
+		ef := t.Ef
+		if ef < request.limit {
+			ef = request.limit
+		}
+		config.Ef(ef)
+	}
+	if _, ok := config.params["searchCoarseCount"]; !ok && t.SearchCoarseCount > 0 {
+		config.SearchCoarseCount(t.SearchCoarseCount)
+	}
+	cloned := *request
+	cloned.set = copyMarks(request.set)
+	return cloned.Config(config)
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// vector_util.go - vector math matching the metric types of Mochow
+
+package api
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Distance computes the distance of the metric as Mochow does: the squared euclidean distance
+// for L2, the inner product for IP and the cosine similarity for COSINE
+func Distance(metric MetricType, a, b FloatVector) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("dimension mismatch: %d and %d", len(a), len(b))
+	}
+	switch metric {
+	case L2:
+		return L2Distance(a, b), nil
+	case IP:
+		return InnerProduct(a, b), nil
+	case COSINE:
+		return CosineSimilarity(a, b), nil
+	}
+	return 0, fmt.Errorf("unsupported metric type '%s'", metric)
+}
+
+// BatchDistance computes the distances from the query to each of the vectors, the norm of the
+// query is computed once for COSINE
+func BatchDistance(metric MetricType, query FloatVector, vectors []FloatVector) ([]float64, error) {
+	if metric != L2 && metric != IP && metric != COSINE {
+		return nil, fmt.Errorf("unsupported metric type '%s'", metric)
+	}
+	queryNorm := math.Sqrt(InnerProduct(query, query))
+	distances := make([]float64, len(vectors))
+	for i, vector := range vectors {
+		if len(vector) != len(query) {
+			return nil, fmt.Errorf("dimension mismatch: %d and %d", len(query), len(vector))
+		}
+		switch metric {
+		case L2:
+			distances[i] = L2Distance(query, vector)
+		case IP:
+			distances[i] = InnerProduct(query, vector)
+		case COSINE:
+			norm := math.Sqrt(InnerProduct(vector, vector))
+			if queryNorm > 0 && norm > 0 {
+				distances[i] = InnerProduct(query, vector) / (queryNorm * norm)
+			}
+		}
+	}
+	return distances, nil
+}
+
+// L2Distance returns the squared euclidean distance, the vectors should have the same dimension
+func L2Distance(a, b FloatVector) float64 {
+	var s0, s1, s2, s3 float64
+	n := len(a) &^ 3
+	for i := 0; i < n; i += 4 {
+		d0 := float64(a[i]) - float64(b[i])
+		d1 := float64(a[i+1]) - float64(b[i+1])
+		d2 := float64(a[i+2]) - float64(b[i+2])
+		d3 := float64(a[i+3]) - float64(b[i+3])
+		s0 += d0 * d0
+		s1 += d1 * d1
+		s2 += d2 * d2
+		s3 += d3 * d3
+	}
+	for i := n; i < len(a); i++ {
+		d := float64(a[i]) - float64(b[i])
+		s0 += d * d
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// InnerProduct returns the dot product, the vectors should have the same dimension
+func InnerProduct(a, b FloatVector) float64 {
+	var s0, s1, s2, s3 float64
+	n := len(a) &^ 3
+	for i := 0; i < n; i += 4 {
+		s0 += float64(a[i]) * float64(b[i])
+		s1 += float64(a[i+1]) * float64(b[i+1])
+		s2 += float64(a[i+2]) * float64(b[i+2])
+		s3 += float64(a[i+3]) * float64(b[i+3])
+	}
+	for i := n; i < len(a); i++ {
+		s0 += float64(a[i]) * float64(b[i])
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// CosineSimilarity returns the cosine of the angle of the vectors, 0 if any of them is zero
+func CosineSimilarity(a, b FloatVector) float64 {
+	normA := InnerProduct(a, a)
+	normB := InnerProduct(b, b)
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return InnerProduct(a, b) / math.Sqrt(normA*normB)
+}
+
+// NormalizeL2 returns the vector scaled to unit length, a zero vector is returned as is
+func NormalizeL2(v FloatVector) FloatVector {
+	normalized := make(FloatVector, len(v))
+	norm := math.Sqrt(InnerProduct(v, v))
+	if norm == 0 {
+		copy(normalized, v)
+		return normalized
+	}
+	for i, x := range v {
+		normalized[i] = float32(float64(x) / norm)
+	}
+	return normalized
+}
+
+// DistanceAscending tells whether smaller distances of the metric are closer, which is true for
+// L2 only
+func DistanceAscending(metric MetricType) bool {
+	return metric == L2
+}
+
+// DistanceToScore converts a distance of the metric to a score which is larger for closer
+// vectors: the negated distance for L2, the distance itself for IP and COSINE
+func DistanceToScore(metric MetricType, distance float64) float64 {
+	if DistanceAscending(metric) {
+		return -distance
+	}
+	return distance
+}
+
+// SortByDistance sorts the rows from the closest to the farthest in the direction of the metric
+func SortByDistance(metric MetricType, rows []RowResult) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return DistanceToScore(metric, rows[i].Distance) > DistanceToScore(metric, rows[j].Distance)
+	})
+}
+
+// HammingDistance returns the number of different bits of the binary vectors
+func HammingDistance(a, b BinaryVector) (int, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("length mismatch: %d and %d bytes", len(a), len(b))
+	}
+	distance := 0
+	n := len(a) &^ 7
+	for i := 0; i < n; i += 8 {
+		distance += bits.OnesCount64(binary.LittleEndian.Uint64(a[i:]) ^ binary.LittleEndian.Uint64(b[i:]))
+	}
+	for i := n; i < len(a); i++ {
+		distance += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return distance, nil
+}
+
+// SparseDotProduct returns the dot product of the sparse vectors
+func SparseDotProduct(a, b SparseFloatVector) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	var sum float64
+	for k, x := range a {
+		if y, ok := b[k]; ok {
+			sum += float64(x) * float64(y)
+		}
+	}
+	return sum
+}
+
+// IndexMetricType returns the metric type of the vector index built on the field, empty if none
+func IndexMetricType(schema *TableSchema, field string) MetricType {
+	var metric MetricType
+	for _, index := range schema.Indexes {
+		if index.Field == field && len(index.MetricType) > 0 {
+			metric = index.MetricType
+		}
+	}
+	return metric
+}
+
+// RowFloatVector decodes the float vector stored in the field of a row returned by the service,
+// whose elements could be any number
+func RowFloatVector(row Row, field string) (FloatVector, error) {
+	switch v := row.Fields[field].(type) {
+	case []interface{}:
+		vector := make(FloatVector, len(v))
+		for i, element := range v {
+			f, ok := toFloat64(element)
+			if !ok {
+				return nil, fmt.Errorf("field '%s' is not a float vector", field)
+			}
+			vector[i] = float32(f)
+		}
+		return vector, nil
+	case []float32:
+		return FloatVector(v), nil
+	case FloatVector:
+		return v, nil
+	case nil:
+		return nil, fmt.Errorf("field '%s' is not retrieved", field)
+	}
+	return nil, fmt.Errorf("field '%s' is not a float vector", field)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// histogram.go - a high dynamic range histogram of latencies
+
+package bench
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	subBucketBits  = 11 // 2048 sub buckets, 3 significant decimal digits
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+// Histogram records durations in nanoseconds with a relative error below 0.1% like an HDR
+// histogram: values below 2048 are counted exactly, larger values in buckets of 1024 sub buckets
+// whose width doubles from one bucket to the next. It is not safe for concurrent use.
+type Histogram struct {
+	counts []int64
+	total  int64
+	sum    float64
+	min    int64
+	max    int64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]int64, subBucketCount)}
+}
+
+// Record counts the duration, negative durations are counted as zero
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	index := countsIndex(v)
+	if index >= len(h.counts) {
+		counts := make([]int64, index+subBucketHalf)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[index]++
+	if h.total == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.total++
+	h.sum += float64(v)
+}
+
+// Merge adds the counts of the other histogram
+func (h *Histogram) Merge(other *Histogram) {
+	if other.total == 0 {
+		return
+	}
+	if len(other.counts) > len(h.counts) {
+		counts := make([]int64, len(other.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	if h.total == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.total += other.total
+	h.sum += other.sum
+}
+
+// Count returns the number of recorded durations
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+func (h *Histogram) Min() time.Duration {
+	return time.Duration(h.min)
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.total))
+}
+
+// Quantile returns the duration below which the fraction q of the durations fall, e.g. 0.99,
+// as the highest value equivalent to the bucket of the duration
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if q >= 1 {
+		return time.Duration(h.max)
+	}
+	rank := int64(math.Ceil(q * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := highestEquivalent(i)
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+// countsIndex returns the index of the counter of the value
+func countsIndex(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBucketBits
+	subBucket := int(v >> uint(shift)) // in [subBucketHalf, subBucketCount)
+	return subBucketCount + (shift-1)*subBucketHalf + subBucket - subBucketHalf
+}
+
+// highestEquivalent returns the largest value counted by the counter of the index
+func highestEquivalent(index int) int64 {
+	if index < subBucketCount {
+		return int64(index)
+	}
+	shift := (index-subBucketCount)/subBucketHalf + 1
+	subBucket := int64((index-subBucketCount)%subBucketHalf + subBucketHalf)
+	return (subBucket+1)<<uint(shift) - 1
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// report.go - the results of a benchmark and their JSON export
+
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// LatencySummary holds the latency percentiles of the succeeded requests in milliseconds
+type LatencySummary struct {
+	Min  float64 `json:"minMs"`
+	Mean float64 `json:"meanMs"`
+	P50  float64 `json:"p50Ms"`
+	P90  float64 `json:"p90Ms"`
+	P99  float64 `json:"p99Ms"`
+	P999 float64 `json:"p999Ms"`
+	Max  float64 `json:"maxMs"`
+}
+
+// OperationReport holds the results of an operation, Throughput being the requests per second.
+// The failed requests are counted by the code of the error returned by the server in
+// ErrorsByCode, or in ClientErrors for the errors raised on the client side such as timeouts.
+type OperationReport struct {
+	Requests     int64                       `json:"requests"`
+	Errors       int64                       `json:"errors"`
+	ClientErrors int64                       `json:"clientErrors,omitempty"`
+	ErrorsByCode map[api.ServerErrCode]int64 `json:"errorsByCode,omitempty"`
+	Throughput   float64                     `json:"throughput"`
+	Latency      LatencySummary              `json:"latency"`
+}
+
+// Report holds the results of a benchmark, overall and per operation. Dropped counts the
+// requests of the target rate not sent because all the workers were busy, ErrorMessages holds
+// the first message of each error code, "client" for the client errors.
+type Report struct {
+	StartTime       time.Time                      `json:"startTime"`
+	DurationSeconds float64                        `json:"durationSeconds"`
+	TargetQPS       float64                        `json:"targetQps,omitempty"`
+	Concurrency     int                            `json:"concurrency"`
+	Dropped         int64                          `json:"dropped,omitempty"`
+	Total           OperationReport                `json:"total"`
+	Operations      map[Operation]*OperationReport `json:"operations"`
+	ErrorMessages   map[string]string              `json:"errorMessages,omitempty"`
+}
+
+func newReport(options *Options, start time.Time, elapsed time.Duration,
+	workers []map[Operation]*opStats, dropped int64) *Report {
+	report := &Report{
+		StartTime:       start,
+		DurationSeconds: elapsed.Seconds(),
+		TargetQPS:       options.QPS,
+		Concurrency:     options.Concurrency,
+		Dropped:         dropped,
+		Operations:      make(map[Operation]*OperationReport),
+	}
+	total := newOpStats()
+	merged := make(map[Operation]*opStats)
+	for _, stats := range workers {
+		for op, s := range stats {
+			if _, ok := merged[op]; !ok {
+				merged[op] = newOpStats()
+			}
+			merged[op].merge(s)
+			total.merge(s)
+		}
+	}
+	for op, s := range merged {
+		report.Operations[op] = s.report(elapsed)
+	}
+	report.Total = *total.report(elapsed)
+	report.ErrorMessages = total.messages
+	return report
+}
+
+func (s *opStats) report(elapsed time.Duration) *OperationReport {
+	report := &OperationReport{
+		Requests:     s.requests,
+		Errors:       s.errors,
+		ClientErrors: s.clientErrors,
+		ErrorsByCode: s.errorsByCode,
+		Latency:      summarize(s.histogram),
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(s.requests) / elapsed.Seconds()
+	}
+	return report
+}
+
+func summarize(h *Histogram) LatencySummary {
+	return LatencySummary{
+		Min:  milliseconds(h.Min()),
+		Mean: milliseconds(h.Mean()),
+		P50:  milliseconds(h.Quantile(0.5)),
+		P90:  milliseconds(h.Quantile(0.9)),
+		P99:  milliseconds(h.Quantile(0.99)),
+		P999: milliseconds(h.Quantile(0.999)),
+		Max:  milliseconds(h.Max()),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// WriteJSON writes the report as indented JSON, e.g. to track the results in CI
+func (r *Report) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadReport reads a report written by WriteJSON
+func ReadReport(r io.Reader) (*Report, error) {
+	report := &Report{}
+	if err := json.NewDecoder(r).Decode(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// WriteTable writes the operations and the total as a table followed by the error breakdown
+func (r *Report) WriteTable(w io.Writer) error {
+	ops := make([]string, 0, len(r.Operations))
+	for op := range r.Operations {
+		ops = append(ops, string(op))
+	}
+	sort.Strings(ops)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "operation\trequests\terrors\tqps\tmean\tp50\tp90\tp99\tp99.9\tmax\t\n")
+	writeRow := func(name string, op *OperationReport) {
+		l := op.Latency
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t\n", name, op.Requests,
+			op.Errors, op.Throughput, l.Mean, l.P50, l.P90, l.P99, l.P999, l.Max)
+	}
+	for _, op := range ops {
+		writeRow(op, r.Operations[Operation(op)])
+	}
+	writeRow("total", &r.Total)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "latencies in ms over %.1fs", r.DurationSeconds)
+	if r.Dropped > 0 {
+		fmt.Fprintf(w, ", %d requests of the target rate dropped", r.Dropped)
+	}
+	fmt.Fprintln(w)
+
+	codes := make([]int, 0, len(r.Total.ErrorsByCode))
+	for code := range r.Total.ErrorsByCode {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "error %d x%d: %s\n", code, r.Total.ErrorsByCode[api.ServerErrCode(code)],
+			r.ErrorMessages[fmt.Sprint(code)])
+	}
+	if r.Total.ClientErrors > 0 {
+		fmt.Fprintf(w, "client error x%d: %s\n", r.Total.ClientErrors, r.ErrorMessages["client"])
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// runner.go - drive the operations at a target rate or a fixed concurrency
+
+// Package bench implements a load generator sending a mix of row and search requests to a table,
+// reporting the throughput, the errors and the latency percentiles.
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+const (
+	DefaultConcurrency = 8
+	DefaultDuration    = 10 * time.Second
+	DefaultBatchSize   = 10
+	DefaultLimit       = 10
+	DefaultKeySpace    = 100000
+)
+
+// Options describes the benchmark. Concurrency workers send the operations drawn from Mix, which
+// defaults to vector searches only. With QPS set, the requests are started at that total rate
+// as long as a worker is free, otherwise each worker sends its next request when the previous
+// one is answered. The benchmark stops after Requests requests if set, otherwise after Duration.
+//
+// Inserts write BatchSize rows with sequential keys from KeyStart, the other fields are random
+// values derived from the key. Upserts and queries address keys already written by the
+// benchmark, or keys in [KeyStart, KeyStart+KeySpace) before any insert. Searches use random
+// unit vectors on VectorField, the first float vector field by default, and texts drawn from
+// SearchTexts on BM25IndexName, the first inverted index by default.
+type Options struct {
+	Database      string
+	Table         string
+	Mix           Mix
+	QPS           float64
+	Concurrency   int
+	Duration      time.Duration
+	Requests      int64
+	BatchSize     int
+	VectorField   string
+	BM25IndexName string
+	SearchTexts   []string
+	Limit         uint32
+	KeyStart      int64
+	KeySpace      int64
+	Seed          int64
+}
+
+type benchmark struct {
+	client   client.Client
+	options  Options
+	workload *workload
+	picker   *picker
+	nextKey  int64 // accessed atomically
+	issued   int64 // accessed atomically
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Run runs the benchmark against the table and returns its report, the failed requests are
+// reported and do not fail the benchmark
+func Run(cli client.Client, options *Options) (*Report, error) {
+	b := &benchmark{client: cli, options: *options, stop: make(chan struct{})}
+	opts := &b.options
+	if len(opts.Mix) == 0 {
+		opts.Mix = Mix{OpVectorSearch: 1}
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.Requests <= 0 && opts.Duration <= 0 {
+		opts.Duration = DefaultDuration
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.KeySpace <= 0 {
+		opts.KeySpace = DefaultKeySpace
+	}
+	if opts.QPS < 0 {
+		return nil, fmt.Errorf("qps should not be negative")
+	}
+	var err error
+	if b.picker, err = newPicker(opts.Mix); err != nil {
+		return nil, err
+	}
+	desc, err := api.DescTable(cli, &api.DescTableArgs{Database: opts.Database, Table: opts.Table})
+	if err != nil {
+		return nil, err
+	}
+	if desc.Table == nil || desc.Table.Schema == nil {
+		return nil, fmt.Errorf("schema of table '%s' is not available", opts.Table)
+	}
+	if b.workload, err = newWorkload(desc.Table.Schema, opts); err != nil {
+		return nil, err
+	}
+	if err := b.workload.check(opts.Mix); err != nil {
+		return nil, err
+	}
+	b.nextKey = opts.KeyStart
+
+	var tokens chan struct{}
+	var dropped int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	if opts.QPS > 0 {
+		tokens = make(chan struct{}, opts.Concurrency)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dropped = b.pace(tokens, start)
+		}()
+	}
+	if opts.Requests <= 0 {
+		timer := time.AfterFunc(opts.Duration, b.halt)
+		defer timer.Stop()
+	}
+	workers := make([]map[Operation]*opStats, opts.Concurrency)
+	for i := range workers {
+		workers[i] = make(map[Operation]*opStats)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b.work(rand.New(rand.NewSource(opts.Seed+int64(i))), tokens, workers[i])
+		}(i)
+	}
+	wg.Wait()
+	return newReport(opts, start, time.Since(start), workers, dropped), nil
+}
+
+func (b *benchmark) halt() {
+	b.stopOnce.Do(func() { close(b.stop) })
+}
+
+// pace offers a token to the workers at the target rate and returns the number of tokens dropped
+// because all the workers were busy
+func (b *benchmark) pace(tokens chan<- struct{}, start time.Time) int64 {
+	interval := time.Duration(float64(time.Second) / b.options.QPS)
+	var dropped int64
+	for n := int64(0); ; n++ {
+		if wait := time.Until(start.Add(time.Duration(n) * interval)); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-b.stop:
+				timer.Stop()
+				return dropped
+			case <-timer.C:
+			}
+		}
+		select {
+		case <-b.stop:
+			return dropped
+		case tokens <- struct{}{}:
+		default:
+			dropped++
+		}
+	}
+}
+
+func (b *benchmark) work(r *rand.Rand, tokens <-chan struct{}, stats map[Operation]*opStats) {
+	for {
+		if tokens != nil {
+			select {
+			case <-b.stop:
+				return
+			case <-tokens:
+			}
+		} else {
+			select {
+			case <-b.stop:
+				return
+			default:
+			}
+		}
+		if b.options.Requests > 0 {
+			n := atomic.AddInt64(&b.issued, 1)
+			if n > b.options.Requests {
+				b.halt()
+				return
+			}
+		}
+		op := b.picker.pick(r)
+		begin := time.Now()
+		err := b.execute(op, r)
+		elapsed := time.Since(begin)
+		s, ok := stats[op]
+		if !ok {
+			s = newOpStats()
+			stats[op] = s
+		}
+		s.record(elapsed, err)
+	}
+}
+
+func (b *benchmark) execute(op Operation, r *rand.Rand) error {
+	w := b.workload
+	database, table := b.options.Database, b.options.Table
+	var err error
+	switch op {
+	case OpInsert:
+		n := int64(b.options.BatchSize)
+		first := atomic.AddInt64(&b.nextKey, n) - n
+		rows := make([]api.Row, n)
+		for i := range rows {
+			rows[i] = w.row(first + int64(i))
+		}
+		_, err = api.InsertRow(b.client, &api.InsertRowArgs{Database: database, Table: table, Rows: rows})
+	case OpUpsert:
+		rows := make([]api.Row, b.options.BatchSize)
+		for i := range rows {
+			rows[i] = w.row(b.randomKey(r))
+		}
+		_, err = api.UpsertRow(b.client, &api.UpsertRowArg{Database: database, Table: table, Rows: rows})
+	case OpQuery:
+		primaryKey, partitionKey := w.queryKeys(b.randomKey(r))
+		_, err = api.QueryRow(b.client, &api.QueryRowArgs{
+			Database:     database,
+			Table:        table,
+			PrimaryKey:   primaryKey,
+			PartitionKey: partitionKey,
+		})
+	case OpVectorSearch:
+		_, err = api.VectorSearch(b.client, &api.VectorSearchArgs{
+			Database: database,
+			Table:    table,
+			Request:  w.vectorRequest(r),
+		})
+	case OpBM25Search:
+		_, err = api.BM25Search(b.client, &api.BM25SearchArgs{
+			Database: database,
+			Table:    table,
+			Request:  w.bm25Request(r),
+		})
+	case OpHybridSearch:
+		request := api.HybridSearchRequest{}.New(w.vectorRequest(r), w.bm25Request(r), 0.5, 0.5).Limit(w.limit)
+		_, err = api.HybridSearch(b.client, &api.HybridSearchArgs{
+			Database: database,
+			Table:    table,
+			Request:  request,
+		})
+	}
+	return err
+}
+
+// randomKey returns a key written by the benchmark, or a key of the key space if none
+func (b *benchmark) randomKey(r *rand.Rand) int64 {
+	start := b.options.KeyStart
+	if written := atomic.LoadInt64(&b.nextKey) - start; written > 0 {
+		return start + r.Int63n(written)
+	}
+	return start + r.Int63n(b.options.KeySpace)
+}
+
+// opStats accumulates the requests of an operation within a worker
+type opStats struct {
+	histogram    *Histogram
+	requests     int64
+	errors       int64
+	clientErrors int64
+	errorsByCode map[api.ServerErrCode]int64
+	messages     map[string]string
+}
+
+func newOpStats() *opStats {
+	return &opStats{
+		histogram:    NewHistogram(),
+		errorsByCode: make(map[api.ServerErrCode]int64),
+		messages:     make(map[string]string),
+	}
+}
+
+// record counts the request, the latency of the failed ones is not recorded
+func (s *opStats) record(latency time.Duration, err error) {
+	s.requests++
+	if err == nil {
+		s.histogram.Record(latency)
+		return
+	}
+	s.errors++
+	var serviceErr *client.BceServiceError
+	key := "client"
+	if errors.As(err, &serviceErr) {
+		code := api.ServerErrCode(serviceErr.Code)
+		s.errorsByCode[code]++
+		key = fmt.Sprint(code)
+	} else {
+		s.clientErrors++
+	}
+	if _, ok := s.messages[key]; !ok {
+		s.messages[key] = err.Error()
+	}
+}
+
+func (s *opStats) merge(other *opStats) {
+	s.histogram.Merge(other.histogram)
+	s.requests += other.requests
+	s.errors += other.errors
+	s.clientErrors += other.clientErrors
+	for code, n := range other.errorsByCode {
+		s.errorsByCode[code] += n
+	}
+	for key, message := range other.messages {
+		if _, ok := s.messages[key]; !ok {
+			s.messages[key] = message
+		}
+	}
+}
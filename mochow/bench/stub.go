@@ -0,0 +1,129 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// stub.go - a local server answering the requests of the benchmark for transport only runs
+
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// StubServer is a local HTTP server answering the requests of the benchmark with canned
+// responses after Latency, without storing anything, so that a benchmark against it measures
+// the SDK and the transport alone. The table described is the one given at its creation.
+type StubServer struct {
+	*httptest.Server
+	latency     time.Duration
+	description []byte
+}
+
+// StubSchema returns the schema of a table with a UINT64 primary key "id", a float vector field
+// "vector" of the dimension indexed by HNSW with L2 and a text field "text" indexed for BM25
+func StubSchema(dimension uint32) *api.TableSchema {
+	return &api.TableSchema{
+		Fields: []api.FieldSchema{
+			{FieldName: "id", FieldType: api.FieldTypeUint64, PrimaryKey: true, PartitionKey: true, NotNull: true},
+			{FieldName: "vector", FieldType: api.FieldTypeFloatVector, Dimension: dimension, NotNull: true},
+			{FieldName: "text", FieldType: api.FieldTypeText},
+		},
+		Indexes: []api.IndexSchema{
+			{IndexName: "vector_idx", IndexType: api.HNSW, MetricType: api.L2, Field: "vector"},
+			{IndexName: "text_idx", IndexType: api.InvertedIndex, InvertedIndexFields: []string{"text"}},
+		},
+	}
+}
+
+// NewStubServer starts a stub server describing the table with the schema, StubSchema(128) if
+// nil. The server should be closed after use.
+func NewStubServer(database, table string, schema *api.TableSchema, latency time.Duration) (*StubServer, error) {
+	if schema == nil {
+		schema = StubSchema(128)
+	}
+	description, err := json.Marshal(map[string]interface{}{
+		"code": 0,
+		"msg":  "Success",
+		"table": &api.TableDescription{
+			Database: database,
+			Table:    table,
+			State:    api.TableStateNormal,
+			Schema:   schema,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &StubServer{latency: latency, description: description}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s, nil
+}
+
+func (s *StubServer) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.latency > 0 {
+		time.Sleep(s.latency)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.RawQuery
+	switch {
+	case strings.HasSuffix(r.URL.Path, api.RequestTableURI) && hasParam(query, "desc"):
+		w.Write(s.description)
+	case hasParam(query, "insert") || hasParam(query, "upsert"):
+		var args struct {
+			Rows []json.RawMessage `json:"rows"`
+		}
+		if err := json.Unmarshal(body, &args); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":1,"msg":"invalid rows"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"code":0,"msg":"Success","affectedCount":%d}`, len(args.Rows))
+	case hasParam(query, "query"):
+		w.Write([]byte(`{"code":0,"msg":"Success","row":{"id":1}}`))
+	case hasParam(query, "search"):
+		var sb strings.Builder
+		sb.WriteString(`{"code":0,"msg":"Success","rows":[`)
+		for i := 0; i < DefaultLimit; i++ {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			fmt.Fprintf(&sb, `{"row":{"id":%d},"distance":%g,"score":%g}`, i+1, float64(i)/10, 1/float64(i+1))
+		}
+		sb.WriteString(`]}`)
+		w.Write([]byte(sb.String()))
+	default:
+		w.Write([]byte(`{"code":0,"msg":"Success"}`))
+	}
+}
+
+func hasParam(query, param string) bool {
+	for _, p := range strings.Split(query, "&") {
+		if p == param || strings.HasPrefix(p, param+"=") {
+			return true
+		}
+	}
+	return false
+}
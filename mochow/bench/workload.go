@@ -0,0 +1,331 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// workload.go - the operations of the benchmark and the synthetic rows they write and read
+
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// Operation is a kind of request sent by the benchmark
+type Operation string
+
+const (
+	OpInsert       Operation = "insert"
+	OpUpsert       Operation = "upsert"
+	OpVectorSearch Operation = "vectorSearch"
+	OpBM25Search   Operation = "bm25Search"
+	OpHybridSearch Operation = "hybridSearch"
+	OpQuery        Operation = "query"
+)
+
+// Mix gives the relative frequency of the operations, e.g. {OpVectorSearch: 8, OpInsert: 2}
+type Mix map[Operation]int
+
+// ParseMix parses a mix written as "vectorSearch=8,insert=2"
+func ParseMix(s string) (Mix, error) {
+	mix := make(Mix)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		weight := 1
+		if len(parts) == 2 {
+			w, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("invalid weight of '%s'", item)
+			}
+			weight = w
+		}
+		op := Operation(strings.TrimSpace(parts[0]))
+		if !op.valid() {
+			return nil, fmt.Errorf("unsupported operation '%s'", op)
+		}
+		mix[op] += weight
+	}
+	return mix, nil
+}
+
+func (op Operation) valid() bool {
+	switch op {
+	case OpInsert, OpUpsert, OpVectorSearch, OpBM25Search, OpHybridSearch, OpQuery:
+		return true
+	}
+	return false
+}
+
+// picker draws the operations of a mix in proportion to their weights
+type picker struct {
+	ops     []Operation
+	cumsums []int
+}
+
+func newPicker(mix Mix) (*picker, error) {
+	p := &picker{}
+	ops := make([]Operation, 0, len(mix))
+	for op := range mix {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i] < ops[j] })
+	total := 0
+	for _, op := range ops {
+		if !op.valid() {
+			return nil, fmt.Errorf("unsupported operation '%s'", op)
+		}
+		if mix[op] <= 0 {
+			continue
+		}
+		total += mix[op]
+		p.ops = append(p.ops, op)
+		p.cumsums = append(p.cumsums, total)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("mix should have a positive weight")
+	}
+	return p, nil
+}
+
+func (p *picker) pick(r *rand.Rand) Operation {
+	n := r.Intn(p.cumsums[len(p.cumsums)-1])
+	i := sort.SearchInts(p.cumsums, n+1)
+	return p.ops[i]
+}
+
+// workload builds the rows and the requests from the schema of the table
+type workload struct {
+	fields        []api.FieldSchema
+	primaryKeys   []api.FieldSchema
+	partitionKeys []api.FieldSchema
+	vectorField   *api.FieldSchema
+	bm25Index     string
+	searchTexts   []string
+	limit         uint32
+}
+
+var benchWords = []string{
+	"vector", "database", "search", "index", "query", "table", "row", "field", "score", "distance",
+	"cluster", "partition", "replica", "filter", "embedding", "document", "recall", "latency",
+}
+
+func newWorkload(schema *api.TableSchema, options *Options) (*workload, error) {
+	w := &workload{searchTexts: options.SearchTexts, limit: options.Limit}
+	for i := range schema.Fields {
+		field := schema.Fields[i]
+		if field.AutoIncrement {
+			continue
+		}
+		w.fields = append(w.fields, field)
+		if field.PrimaryKey {
+			w.primaryKeys = append(w.primaryKeys, field)
+		}
+		if field.PartitionKey && !field.PrimaryKey {
+			w.partitionKeys = append(w.partitionKeys, field)
+		}
+		if field.FieldType == api.FieldTypeFloatVector && w.vectorField == nil &&
+			(len(options.VectorField) == 0 || options.VectorField == field.FieldName) {
+			w.vectorField = &schema.Fields[i]
+		}
+	}
+	if len(options.VectorField) > 0 && w.vectorField == nil {
+		return nil, fmt.Errorf("float vector field '%s' does not exist", options.VectorField)
+	}
+	w.bm25Index = options.BM25IndexName
+	if len(w.bm25Index) == 0 {
+		for _, index := range schema.Indexes {
+			if index.IndexType == api.InvertedIndex {
+				w.bm25Index = index.IndexName
+				break
+			}
+		}
+	}
+	if len(w.searchTexts) == 0 {
+		w.searchTexts = benchWords
+	}
+	if w.limit == 0 {
+		w.limit = DefaultLimit
+	}
+	return w, nil
+}
+
+// check tells whether the table supports the operations of the mix
+func (w *workload) check(mix Mix) error {
+	for op, weight := range mix {
+		if weight <= 0 {
+			continue
+		}
+		switch op {
+		case OpInsert, OpUpsert, OpQuery:
+			if len(w.primaryKeys) == 0 {
+				return fmt.Errorf("%s needs a primary key which is not auto incremented", op)
+			}
+		case OpVectorSearch:
+			if w.vectorField == nil {
+				return fmt.Errorf("%s needs a float vector field", op)
+			}
+		case OpBM25Search:
+			if len(w.bm25Index) == 0 {
+				return fmt.Errorf("%s needs an inverted index", op)
+			}
+		case OpHybridSearch:
+			if w.vectorField == nil || len(w.bm25Index) == 0 {
+				return fmt.Errorf("%s needs a float vector field and an inverted index", op)
+			}
+		}
+	}
+	return nil
+}
+
+// row returns the row of the key, the values are derived from the key so that the keys of the
+// row could be rebuilt for a query
+func (w *workload) row(key int64) api.Row {
+	r := rand.New(rand.NewSource(key))
+	fields := make(map[string]interface{}, len(w.fields))
+	for _, field := range w.fields {
+		if field.PrimaryKey {
+			fields[field.FieldName] = keyValue(field.FieldType, key)
+			continue
+		}
+		if value := randomValue(r, &field); value != nil {
+			fields[field.FieldName] = value
+		}
+	}
+	return api.Row{Fields: fields}
+}
+
+func (w *workload) queryKeys(key int64) (map[string]interface{}, map[string]interface{}) {
+	row := w.row(key)
+	primaryKey := make(map[string]interface{}, len(w.primaryKeys))
+	for _, field := range w.primaryKeys {
+		primaryKey[field.FieldName] = row.Fields[field.FieldName]
+	}
+	if len(w.partitionKeys) == 0 {
+		return primaryKey, nil
+	}
+	partitionKey := make(map[string]interface{}, len(w.partitionKeys))
+	for _, field := range w.partitionKeys {
+		partitionKey[field.FieldName] = row.Fields[field.FieldName]
+	}
+	return primaryKey, partitionKey
+}
+
+func (w *workload) vectorRequest(r *rand.Rand) *api.VectorTopkSearchRequest {
+	return api.VectorTopkSearchRequest{}.New(w.vectorField.FieldName,
+		randomFloatVector(r, int(w.vectorField.Dimension)), w.limit)
+}
+
+func (w *workload) bm25Request(r *rand.Rand) *api.BM25SearchRequest {
+	return api.BM25SearchRequest{}.New(w.bm25Index, w.searchTexts[r.Intn(len(w.searchTexts))]).
+		Limit(w.limit)
+}
+
+func keyValue(fieldType api.FieldType, key int64) interface{} {
+	switch fieldType {
+	case api.FieldTypeString, api.FieldTypeText, api.FieldTypeTextGBK, api.FieldTypeTextGB18030:
+		return "bench-" + strconv.FormatInt(key, 10)
+	case api.FieldTypeUUID:
+		return fmt.Sprintf("00000000-0000-4000-8000-%012x", key)
+	case api.FieldTypeInt8:
+		return int8(key)
+	case api.FieldTypeUint8:
+		return uint8(key)
+	case api.FieldTypeInt16:
+		return int16(key)
+	case api.FieldTypeUint16:
+		return uint16(key)
+	case api.FieldTypeInt32:
+		return int32(key)
+	case api.FieldTypeUint32:
+		return uint32(key)
+	case api.FieldTypeUint64:
+		return uint64(key)
+	}
+	return key
+}
+
+// randomValue returns a random value of the field, nil for the types left unset
+func randomValue(r *rand.Rand, field *api.FieldSchema) interface{} {
+	switch field.FieldType {
+	case api.FieldTypeBool:
+		return r.Intn(2) == 1
+	case api.FieldTypeInt8:
+		return int8(r.Intn(128))
+	case api.FieldTypeUint8:
+		return uint8(r.Intn(256))
+	case api.FieldTypeInt16:
+		return int16(r.Intn(1 << 15))
+	case api.FieldTypeUint16:
+		return uint16(r.Intn(1 << 16))
+	case api.FieldTypeInt32:
+		return r.Int31()
+	case api.FieldTypeUint32:
+		return r.Uint32()
+	case api.FieldTypeInt64:
+		return r.Int63()
+	case api.FieldTypeUint64:
+		return uint64(r.Int63())
+	case api.FieldTypeFloat:
+		return r.Float32()
+	case api.FieldTypeDouble:
+		return r.Float64()
+	case api.FieldTypeDate:
+		return randomTime(r).Format("2006-01-02")
+	case api.FieldTypeDatetime, api.FieldTypeTimestamp:
+		return randomTime(r).Format("2006-01-02 15:04:05")
+	case api.FieldTypeString, api.FieldTypeText, api.FieldTypeTextGBK, api.FieldTypeTextGB18030:
+		words := make([]string, 1+r.Intn(8))
+		for i := range words {
+			words[i] = benchWords[r.Intn(len(benchWords))]
+		}
+		return strings.Join(words, " ")
+	case api.FieldTypeUUID:
+		return fmt.Sprintf("%08x-%04x-4%03x-8%03x-%012x", r.Uint32(), r.Intn(1<<16), r.Intn(1<<12),
+			r.Intn(1<<12), r.Int63n(1<<48))
+	case api.FieldTypeFloatVector:
+		return randomFloatVector(r, int(field.Dimension))
+	case api.FieldTypeBinaryVector:
+		vector := make(api.BinaryVector, (field.Dimension+7)/8)
+		r.Read(vector)
+		return vector
+	case api.FieldTypeSparseVector:
+		vector := make(api.SparseFloatVector)
+		for i := 0; i < 8; i++ {
+			vector[strconv.Itoa(r.Intn(1<<16))] = r.Float32()
+		}
+		return vector
+	}
+	return nil
+}
+
+func randomFloatVector(r *rand.Rand, dimension int) api.FloatVector {
+	vector := make(api.FloatVector, dimension)
+	for i := range vector {
+		vector[i] = float32(r.NormFloat64())
+	}
+	return api.NormalizeL2(vector)
+}
+
+func randomTime(r *rand.Rand) time.Time {
+	return time.Unix(1577836800+r.Int63n(10*365*24*3600), 0).UTC()
+}
@@ -18,6 +18,7 @@ package mochow
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/baidu/mochow-sdk-go/v2/auth"
 	"github.com/baidu/mochow-sdk-go/v2/client"
@@ -26,6 +27,10 @@ import (
 
 type Client struct {
 	*client.BceClient
+	chunkOptions *api.ChunkOptions
+
+	tunedLock    sync.RWMutex
+	tunedConfigs map[string][]*api.TunedSearchConfig // keyed by database and table
 }
 
 type ClientConfiguration struct {
@@ -36,6 +41,17 @@ type ClientConfiguration struct {
 	ConnectionTimeoutMS int
 	RequestTimeoutMS    int
 	MaxRetry            int
+
+	// Split InsertRow, UpsertRow and BatchQueryRow requests exceeding the limits into several
+	// requests, 0 means no limit. The chunks are executed by at most RowRequestParallelism
+	// concurrent requests.
+	MaxRowsPerRequest     int
+	MaxBytesPerRequest    int
+	RowRequestParallelism int
+
+	// Search parameters applied to the VectorTopkSearchRequests of the tables, see
+	// SetTunedSearchConfig
+	TunedSearchConfigs []*api.TunedSearchConfig
 }
 
 // NewClient make the Mochow service client with default configuration.
@@ -96,8 +112,28 @@ func NewClientWithConfig(config *ClientConfiguration) (*Client, error) {
 		defaultConf.Retry = client.NewBackOffRetryPolicy(config.MaxRetry, 20000, 300)
 	}
 
+	// Check row request split options
+	if config.MaxRowsPerRequest < 0 || config.MaxBytesPerRequest < 0 || config.RowRequestParallelism < 0 {
+		return nil, errors.New("row request split options is negative")
+	}
+	var chunkOptions *api.ChunkOptions
+	if config.MaxRowsPerRequest > 0 || config.MaxBytesPerRequest > 0 {
+		chunkOptions = &api.ChunkOptions{
+			MaxRowsPerRequest:  config.MaxRowsPerRequest,
+			MaxBytesPerRequest: config.MaxBytesPerRequest,
+			Parallelism:        config.RowRequestParallelism,
+		}
+	}
+
 	v1Signer := &auth.BceV1Signer{}
-	client := &Client{client.NewBceClient(defaultConf, v1Signer)}
+	client := &Client{
+		BceClient:    client.NewBceClient(defaultConf, v1Signer),
+		chunkOptions: chunkOptions,
+		tunedConfigs: make(map[string][]*api.TunedSearchConfig),
+	}
+	for _, tuned := range config.TunedSearchConfigs {
+		client.SetTunedSearchConfig(tuned)
+	}
 	return client, nil
 }
 
@@ -201,12 +237,15 @@ func (c *Client) RebuildIndex(database, table, indexName string) error {
 	return api.RebuildIndex(c, args)
 }
 
+// InsertRow inserts the rows, the request is split as configured by MaxRowsPerRequest and
+// MaxBytesPerRequest. A *api.PartialFailureError is returned when only part of the rows inserted.
 func (c *Client) InsertRow(args *api.InsertRowArgs) (*api.InsertRowResult, error) {
-	return api.InsertRow(c, args)
+	return api.ChunkedInsertRow(c, args, c.chunkOptions)
 }
 
+// UpsertRow upserts the rows, the request is split in the same way as InsertRow.
 func (c *Client) UpsertRow(args *api.UpsertRowArg) (*api.UpsertRowResult, error) {
-	return api.UpsertRow(c, args)
+	return api.ChunkedUpsertRow(c, args, c.chunkOptions)
 }
 
 func (c *Client) DeleteRow(args *api.DeleteRowArgs) error {
@@ -217,8 +256,15 @@ func (c *Client) QueryRow(args *api.QueryRowArgs) (*api.QueryRowResult, error) {
 	return api.QueryRow(c, args)
 }
 
+// BatchQueryRow queries the rows of the keys, the request is split in the same way as InsertRow.
 func (c *Client) BatchQueryRow(args *api.BatchQueryRowArgs) (*api.BatchQueryRowResult, error) {
-	return api.BatchQueryRow(c, args)
+	return api.ChunkedBatchQueryRow(c, args, c.chunkOptions)
+}
+
+// BatchQueryRowByKeys queries the rows of the keys and maps every row to its key, reporting
+// the keys which are not found.
+func (c *Client) BatchQueryRowByKeys(args *api.BatchQueryRowArgs) (*api.KeyedBatchQueryRowResult, error) {
+	return api.BatchQueryRowByKeys(c, args, c.chunkOptions)
 }
 
 // Deprecated: you should use VectorSearch with VectorTopkSearchRequest or VectorRangeSearchRequest instead.
@@ -226,6 +272,8 @@ func (c *Client) SearchRow(args *api.SearchRowArgs) (*api.SearchRowResult, error
 	return api.SearchRow(c, args)
 }
 
+// VectorSearch searches the vectors, a VectorTopkSearchRequest gets the parameters of the tuned
+// config of its table and field which it does not set.
 func (c *Client) VectorSearch(args *api.VectorSearchArgs) (*api.SearchResult, error) {
 	return api.VectorSearch(c, args)
 }
@@ -257,6 +305,38 @@ func (c *Client) MultivectorSearch(args *api.MultivectorSearchArgs) (*api.Search
 	return api.MultiVectorSearch(c, args)
 }
 
+func (c *Client) GroupSearch(args *api.GroupSearchArgs) (*api.GroupSearchResult, error) {
+	return api.GroupSearch(c, args)
+}
+
+func (c *Client) MMRSearch(args *api.MMRSearchArgs) ([]api.RowResult, error) {
+	return api.MMRSearch(c, args)
+}
+
+func (c *Client) QuantizedSearch(args *api.QuantizedSearchArgs) (*api.SearchResult, error) {
+	return api.QuantizedSearch(c, args)
+}
+
+func (c *Client) FusionSearch(args *api.FusionSearchArgs) (*api.FusionSearchResult, error) {
+	return api.FusionSearch(c, args)
+}
+
+func (c *Client) ExplainSearch(args *api.ExplainSearchArgs) (*api.ExplainSearchResult, error) {
+	return api.ExplainSearch(c, args)
+}
+
+func (c *Client) CollectFusionCandidates(args *api.FusionCandidatesArgs) (*api.FusionCandidates, error) {
+	return api.CollectFusionCandidates(c, args)
+}
+
+func (c *Client) FederatedSearch(args *api.FederatedSearchArgs) (*api.FederatedSearchResult, error) {
+	return api.FederatedSearch(c, args)
+}
+
+func (c *Client) ComputeFacets(args *api.ComputeFacetsArgs) (*api.FacetResult, error) {
+	return api.ComputeFacets(c, args)
+}
+
 func (c *Client) UpdateRow(args *api.UpdateRowArgs) error {
 	return api.UpdateRow(c, args)
 }
@@ -265,11 +345,93 @@ func (c *Client) SelectRow(args *api.SelectRowArgs) (*api.SelectRowResult, error
 	return api.SelectRow(c, args)
 }
 
+func (c *Client) SelectIterator(args *api.SelectRowArgs) *api.SelectIterator {
+	return api.NewSelectIterator(c, args)
+}
+
+func (c *Client) BulkDeleteRow(args *api.BulkDeleteRowArgs) (*api.BulkMutationResult, error) {
+	return api.BulkDeleteRow(c, args)
+}
+
+func (c *Client) UpdateRowByFilter(args *api.UpdateRowByFilterArgs) (*api.BulkMutationResult, error) {
+	return api.UpdateRowByFilter(c, args)
+}
+
+func (c *Client) CountRow(args *api.CountRowArgs) (uint64, error) {
+	return api.CountRow(c, args)
+}
+
+func (c *Client) DistinctRow(args *api.DistinctRowArgs) (*api.DistinctRowResult, error) {
+	return api.DistinctRow(c, args)
+}
+
+func (c *Client) GroupByRow(args *api.GroupByRowArgs) (*api.GroupByRowResult, error) {
+	return api.GroupByRow(c, args)
+}
+
+// EmbeddingTable returns a handle embedding the text fields of rows and search queries, the
+// rows are split as InsertRow and UpsertRow do
+func (c *Client) EmbeddingTable(args *api.EmbeddingTableArgs) (*api.EmbeddingTable, error) {
+	return api.NewEmbeddingTable(c, args, c.chunkOptions)
+}
+
 // Deprecated: you should use VectorSearch with VectorBatchSearchRequest instead.
 func (c *Client) BatchSearchRow(args *api.BatchSearchRowArgs) (*api.BatchSearchRowResult, error) {
 	return api.BatchSearchRow(c, args)
 }
 
+// SetTunedSearchConfig applies the tuned config to the following topk searches of its table and
+// vector field made through the client, e.g. by VectorSearch, api.MMRSearch or an
+// EmbeddingTable, replacing the former config of the field.
+func (c *Client) SetTunedSearchConfig(tuned *api.TunedSearchConfig) {
+	key := tunedConfigKey(tuned.Database, tuned.Table)
+	c.tunedLock.Lock()
+	defer c.tunedLock.Unlock()
+	configs := make([]*api.TunedSearchConfig, 0, len(c.tunedConfigs[key])+1)
+	for _, config := range c.tunedConfigs[key] {
+		if config.VectorField != tuned.VectorField {
+			configs = append(configs, config)
+		}
+	}
+	c.tunedConfigs[key] = append(configs, tuned)
+}
+
+// RemoveTunedSearchConfig stops applying the tuned config of the vector field of the table
+func (c *Client) RemoveTunedSearchConfig(database, table, vectorField string) {
+	key := tunedConfigKey(database, table)
+	c.tunedLock.Lock()
+	defer c.tunedLock.Unlock()
+	configs := make([]*api.TunedSearchConfig, 0, len(c.tunedConfigs[key]))
+	for _, config := range c.tunedConfigs[key] {
+		if config.VectorField != vectorField {
+			configs = append(configs, config)
+		}
+	}
+	if len(configs) == 0 {
+		delete(c.tunedConfigs, key)
+	} else {
+		c.tunedConfigs[key] = configs
+	}
+}
+
+// ApplyTunedSearchConfig returns the request with the parameters of the tuned config of its table
+// and vector field, it is called for every topk search sent through the client
+func (c *Client) ApplyTunedSearchConfig(database, table string,
+	request *api.VectorTopkSearchRequest) *api.VectorTopkSearchRequest {
+	c.tunedLock.RLock()
+	defer c.tunedLock.RUnlock()
+	for _, tuned := range c.tunedConfigs[tunedConfigKey(database, table)] {
+		if applied := tuned.ApplyTo(request); applied != request {
+			return applied
+		}
+	}
+	return request
+}
+
+func tunedConfigKey(database, table string) string {
+	return database + "\x00" + table
+}
+
 /********************* Role interfaces *********************/
 func (c *Client) CreateRole(roleName string) error {
 	args := &api.CreateRoleArgs{Role: roleName}
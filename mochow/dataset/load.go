@@ -0,0 +1,279 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// load.go - load a dataset file into a table
+
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+const (
+	DefaultIDField       = "id"
+	DefaultLoadBatchSize = 1000
+)
+
+// LoadArgs describes the load of a dataset file into a table. The i-th vector of the file is
+// written into VectorField, the first vector field of the table by default, of a row whose
+// IDField is IDStart+i unless the field is auto incremented. The float vector fields are loaded
+// from any file, the binary vector fields from the bytes of bvecs or uint8 npy files.
+//
+// MetadataPath is an optional JSONL file whose i-th line is a JSON object holding the other
+// fields of the i-th row, an id given there is kept. The rows are written BatchSize at a time by
+// insert, or upsert if Upsert, each batch split by Chunk if not nil. The vectors before Offset
+// are skipped, e.g. to resume a load from the NextOffset of a failed one, and at most Limit
+// vectors are loaded if Limit is positive.
+type LoadArgs struct {
+	Database     string
+	Table        string
+	Path         string
+	VectorField  string
+	IDField      string
+	IDStart      int64
+	MetadataPath string
+	Offset       int64
+	Limit        int64
+	BatchSize    int
+	Upsert       bool
+	Chunk        *api.ChunkOptions
+}
+
+// LoadResult counts the rows written, NextOffset is the offset of the first vector not written
+type LoadResult struct {
+	Rows       int64
+	NextOffset int64
+}
+
+type loader struct {
+	args        LoadArgs
+	vectorField *api.FieldSchema
+	idField     *api.FieldSchema
+	reader      *Reader
+	metadata    *bufio.Scanner
+	line        int64
+}
+
+// Load loads the dataset file into the table. On failure the rows written so far are counted
+// in the returned result along with the error.
+func Load(cli client.Client, args *LoadArgs) (*LoadResult, error) {
+	l := &loader{args: *args}
+	if len(l.args.IDField) == 0 {
+		l.args.IDField = DefaultIDField
+	}
+	if l.args.BatchSize <= 0 {
+		l.args.BatchSize = DefaultLoadBatchSize
+	}
+	result := &LoadResult{NextOffset: l.args.Offset}
+	if err := l.describe(cli); err != nil {
+		return result, err
+	}
+	reader, err := Open(l.args.Path)
+	if err != nil {
+		return result, err
+	}
+	defer reader.Close()
+	l.reader = reader
+	if err := l.check(); err != nil {
+		return result, err
+	}
+	if len(l.args.MetadataPath) > 0 {
+		file, err := os.Open(l.args.MetadataPath)
+		if err != nil {
+			return result, err
+		}
+		defer file.Close()
+		l.metadata = bufio.NewScanner(file)
+		l.metadata.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	}
+	if err := l.skip(l.args.Offset); err != nil {
+		return result, err
+	}
+
+	rows := make([]api.Row, 0, l.args.BatchSize)
+	for done := false; !done; {
+		rows = rows[:0]
+		for len(rows) < l.args.BatchSize {
+			if l.args.Limit > 0 && result.Rows+int64(len(rows)) >= l.args.Limit {
+				done = true
+				break
+			}
+			row, err := l.next(result.NextOffset + int64(len(rows)))
+			if err == io.EOF {
+				done = true
+				break
+			}
+			if err != nil {
+				return result, err
+			}
+			rows = append(rows, row)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		if err := l.write(cli, rows); err != nil {
+			return result, err
+		}
+		result.Rows += int64(len(rows))
+		result.NextOffset += int64(len(rows))
+	}
+	return result, nil
+}
+
+func (l *loader) describe(cli client.Client) error {
+	desc, err := api.DescTable(cli, &api.DescTableArgs{Database: l.args.Database, Table: l.args.Table})
+	if err != nil {
+		return err
+	}
+	if desc.Table == nil || desc.Table.Schema == nil {
+		return fmt.Errorf("schema of table '%s' is not available", l.args.Table)
+	}
+	fields := desc.Table.Schema.Fields
+	for i := range fields {
+		field := &fields[i]
+		isVector := field.FieldType == api.FieldTypeFloatVector || field.FieldType == api.FieldTypeBinaryVector
+		if l.vectorField == nil && isVector &&
+			(len(l.args.VectorField) == 0 || l.args.VectorField == field.FieldName) {
+			l.vectorField = field
+		}
+		if field.FieldName == l.args.IDField {
+			l.idField = field
+		}
+	}
+	if l.vectorField == nil {
+		if len(l.args.VectorField) > 0 {
+			return fmt.Errorf("vector field '%s' does not exist", l.args.VectorField)
+		}
+		return fmt.Errorf("table '%s' has no float or binary vector field", l.args.Table)
+	}
+	if l.idField == nil {
+		return fmt.Errorf("id field '%s' does not exist", l.args.IDField)
+	}
+	return nil
+}
+
+// check tells whether the vectors of the file fit the vector field
+func (l *loader) check() error {
+	dimension := l.reader.Dimension()
+	if dimension == 0 {
+		return nil
+	}
+	if l.vectorField.FieldType == api.FieldTypeBinaryVector {
+		if l.reader.element != elementUint8 {
+			return fmt.Errorf("binary vector field '%s' could not be loaded from %s elements",
+				l.vectorField.FieldName, l.reader.element)
+		}
+		dimension *= 8
+	}
+	if uint32(dimension) != l.vectorField.Dimension {
+		return fmt.Errorf("vectors of dimension %d do not fit field '%s' of dimension %d",
+			dimension, l.vectorField.FieldName, l.vectorField.Dimension)
+	}
+	return nil
+}
+
+func (l *loader) skip(n int64) error {
+	if err := l.reader.Skip(n); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("offset %d is beyond the end of '%s'", n, l.args.Path)
+		}
+		return err
+	}
+	for ; l.metadata != nil && l.line < n; l.line++ {
+		if !l.metadata.Scan() {
+			return l.metadataEnd()
+		}
+	}
+	return nil
+}
+
+// next returns the row of the vector at the position, io.EOF at the end of the file
+func (l *loader) next(position int64) (api.Row, error) {
+	var vector interface{}
+	var err error
+	if l.vectorField.FieldType == api.FieldTypeBinaryVector {
+		vector, err = l.reader.ReadBinary()
+	} else {
+		vector, err = l.reader.ReadFloat()
+	}
+	if err != nil {
+		return api.Row{}, err
+	}
+	fields := make(map[string]interface{})
+	if l.metadata != nil {
+		if fields, err = l.nextMetadata(); err != nil {
+			return api.Row{}, err
+		}
+	}
+	fields[l.vectorField.FieldName] = vector
+	if _, ok := fields[l.idField.FieldName]; !ok && !l.idField.AutoIncrement {
+		fields[l.idField.FieldName] = idValue(l.idField.FieldType, l.args.IDStart+position)
+	}
+	return api.Row{Fields: fields}, nil
+}
+
+func (l *loader) nextMetadata() (map[string]interface{}, error) {
+	if !l.metadata.Scan() {
+		return nil, l.metadataEnd()
+	}
+	l.line++
+	fields := make(map[string]interface{})
+	line := bytes.TrimSpace(l.metadata.Bytes())
+	if len(line) == 0 {
+		return fields, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("metadata line %d: %v", l.line, err)
+	}
+	return fields, nil
+}
+
+func (l *loader) metadataEnd() error {
+	if err := l.metadata.Err(); err != nil {
+		return fmt.Errorf("metadata line %d: %v", l.line+1, err)
+	}
+	return fmt.Errorf("metadata '%s' has %d lines, fewer than the vectors", l.args.MetadataPath, l.line)
+}
+
+func (l *loader) write(cli client.Client, rows []api.Row) error {
+	args := &api.InsertRowArgs{Database: l.args.Database, Table: l.args.Table, Rows: rows}
+	if l.args.Upsert {
+		_, err := api.ChunkedUpsertRow(cli, (*api.UpsertRowArg)(args), l.args.Chunk)
+		return err
+	}
+	_, err := api.ChunkedInsertRow(cli, args, l.args.Chunk)
+	return err
+}
+
+// idValue returns the id of the type, the ids of the string fields are written in decimal
+func idValue(fieldType api.FieldType, id int64) interface{} {
+	switch fieldType {
+	case api.FieldTypeString, api.FieldTypeText, api.FieldTypeTextGBK, api.FieldTypeTextGB18030:
+		return strconv.FormatInt(id, 10)
+	case api.FieldTypeUint64:
+		return uint64(id)
+	}
+	return id
+}
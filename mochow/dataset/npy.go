@@ -0,0 +1,154 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// npy.go - the header of the NumPy npy files
+
+package dataset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	npyMagic = "\x93NUMPY"
+	// npyHeaderSize is the size of the headers written, large enough for any shape so that the
+	// header could be rewritten in place once the number of vectors is known
+	npyHeaderSize = 128
+)
+
+var (
+	npyDescrPattern   = regexp.MustCompile(`'descr'\s*:\s*'([^']*)'`)
+	npyFortranPattern = regexp.MustCompile(`'fortran_order'\s*:\s*(True|False)`)
+	npyShapePattern   = regexp.MustCompile(`'shape'\s*:\s*\(([^)]*)\)`)
+)
+
+// npyHeader describes an npy array of count vectors of the dimension
+type npyHeader struct {
+	element   elementType
+	count     int64
+	dimension int
+}
+
+// readNpyHeader reads the header of a C ordered little endian array of one or two dimensions,
+// the rows of a one dimensional array being vectors of dimension 1
+func readNpyHeader(r io.Reader) (*npyHeader, error) {
+	var prefix [8]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("npy header: %v", err)
+	}
+	if string(prefix[:6]) != npyMagic {
+		return nil, fmt.Errorf("not an npy file")
+	}
+	var length int
+	switch major := prefix[6]; major {
+	case 1:
+		var size [2]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, fmt.Errorf("npy header: %v", err)
+		}
+		length = int(binary.LittleEndian.Uint16(size[:]))
+	case 2, 3:
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, fmt.Errorf("npy header: %v", err)
+		}
+		length = int(binary.LittleEndian.Uint32(size[:]))
+	default:
+		return nil, fmt.Errorf("unsupported npy version %d.%d", major, prefix[7])
+	}
+	dict := make([]byte, length)
+	if _, err := io.ReadFull(r, dict); err != nil {
+		return nil, fmt.Errorf("npy header: %v", err)
+	}
+	return parseNpyHeader(string(dict))
+}
+
+func parseNpyHeader(dict string) (*npyHeader, error) {
+	header := &npyHeader{}
+	descr := npyDescrPattern.FindStringSubmatch(dict)
+	if descr == nil {
+		return nil, fmt.Errorf("npy header has no descr")
+	}
+	switch descr[1] {
+	case "<f4":
+		header.element = elementFloat32
+	case "|u1", "<u1", "u1":
+		header.element = elementUint8
+	case "<i4":
+		header.element = elementInt32
+	default:
+		return nil, fmt.Errorf("unsupported npy dtype '%s', expect '<f4', '|u1' or '<i4'", descr[1])
+	}
+	if fortran := npyFortranPattern.FindStringSubmatch(dict); fortran != nil && fortran[1] == "True" {
+		return nil, fmt.Errorf("npy arrays in fortran order are not supported")
+	}
+	shape := npyShapePattern.FindStringSubmatch(dict)
+	if shape == nil {
+		return nil, fmt.Errorf("npy header has no shape")
+	}
+	dims := make([]int64, 0, 2)
+	for _, s := range strings.Split(shape[1], ",") {
+		if s = strings.TrimSpace(s); len(s) == 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid npy shape (%s)", shape[1])
+		}
+		dims = append(dims, n)
+	}
+	switch len(dims) {
+	case 1:
+		header.count, header.dimension = dims[0], 1
+	case 2:
+		header.count, header.dimension = dims[0], int(dims[1])
+	default:
+		return nil, fmt.Errorf("npy array of shape (%s) is not a list of vectors", shape[1])
+	}
+	return header, nil
+}
+
+func (e elementType) npyDescr() string {
+	switch e {
+	case elementFloat32:
+		return "<f4"
+	case elementUint8:
+		return "|u1"
+	}
+	return "<i4"
+}
+
+// encode returns the version 1.0 header of npyHeaderSize bytes
+func (h *npyHeader) encode() ([]byte, error) {
+	dict := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%d, %d), }",
+		h.element.npyDescr(), h.count, h.dimension)
+	length := npyHeaderSize - 10
+	if len(dict) >= length {
+		return nil, fmt.Errorf("npy shape (%d, %d) is too large", h.count, h.dimension)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(npyMagic)
+	buf.Write([]byte{1, 0})
+	binary.Write(&buf, binary.LittleEndian, uint16(length))
+	buf.WriteString(dict)
+	buf.WriteString(strings.Repeat(" ", length-len(dict)-1))
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
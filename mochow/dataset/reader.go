@@ -0,0 +1,270 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// reader.go - stream the vectors of the dataset files
+
+package dataset
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// Format is the format of a dataset file
+type Format string
+
+const (
+	FormatFvecs Format = "fvecs" // float32 vectors, each preceded by its dimension
+	FormatBvecs Format = "bvecs" // uint8 vectors, each preceded by its dimension
+	FormatIvecs Format = "ivecs" // int32 vectors, each preceded by its dimension
+	FormatNpy   Format = "npy"   // a 2-D NumPy array of float32, uint8 or int32
+)
+
+// FormatOf returns the format given by the extension of the path
+func FormatOf(path string) (Format, error) {
+	switch format := Format(strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")); format {
+	case FormatFvecs, FormatBvecs, FormatIvecs, FormatNpy:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown dataset format of '%s'", path)
+}
+
+type elementType int
+
+const (
+	elementFloat32 elementType = iota
+	elementUint8
+	elementInt32
+)
+
+func (e elementType) size() int {
+	if e == elementUint8 {
+		return 1
+	}
+	return 4
+}
+
+func (e elementType) String() string {
+	switch e {
+	case elementFloat32:
+		return "float32"
+	case elementUint8:
+		return "uint8"
+	}
+	return "int32"
+}
+
+func vecsElementType(format Format) elementType {
+	switch format {
+	case FormatBvecs:
+		return elementUint8
+	case FormatIvecs:
+		return elementInt32
+	}
+	return elementFloat32
+}
+
+// Reader streams the vectors of a dataset file. All the vectors of a file have the same
+// dimension. The fvecs, ivecs and float32 npy vectors are read as float vectors, bvecs and uint8
+// npy vectors either as float vectors of their values or as binary vectors of their bytes.
+type Reader struct {
+	format    Format
+	r         *bufio.Reader
+	closer    io.Closer
+	element   elementType
+	dimension int
+	count     int64 // -1 if unknown
+	read      int64
+	buf       []byte
+}
+
+// Open opens the dataset file, its format is given by its extension
+func Open(path string) (*Reader, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(file, format)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.closer = file
+	if r.count < 0 {
+		// the vecs files hold vectors of the same size
+		if info, err := file.Stat(); err == nil && r.dimension > 0 {
+			size := int64(4 + r.dimension*r.element.size())
+			if info.Size()%size == 0 {
+				r.count = info.Size() / size
+			}
+		}
+	}
+	return r, nil
+}
+
+// NewReader reads the dataset of the format from r
+func NewReader(r io.Reader, format Format) (*Reader, error) {
+	reader := &Reader{format: format, r: bufio.NewReaderSize(r, 1<<16), count: -1}
+	switch format {
+	case FormatFvecs, FormatBvecs, FormatIvecs:
+		reader.element = vecsElementType(format)
+		header, err := reader.r.Peek(4)
+		if err == io.EOF {
+			reader.count = 0
+			return reader, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		reader.dimension = int(int32(binary.LittleEndian.Uint32(header)))
+		if reader.dimension <= 0 {
+			return nil, fmt.Errorf("invalid dimension %d", reader.dimension)
+		}
+	case FormatNpy:
+		header, err := readNpyHeader(reader.r)
+		if err != nil {
+			return nil, err
+		}
+		reader.element = header.element
+		reader.count = header.count
+		reader.dimension = header.dimension
+	default:
+		return nil, fmt.Errorf("unsupported dataset format '%s'", format)
+	}
+	return reader, nil
+}
+
+func (r *Reader) Format() Format {
+	return r.format
+}
+
+// Dimension returns the number of elements of the vectors, 0 for an empty vecs file
+func (r *Reader) Dimension() int {
+	return r.dimension
+}
+
+// Count returns the number of vectors of the file, -1 if unknown
+func (r *Reader) Count() int64 {
+	return r.count
+}
+
+// Close closes the file opened by Open
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// next returns the raw elements of the next vector, io.EOF at the end
+func (r *Reader) next() ([]byte, error) {
+	if r.count >= 0 && r.read >= r.count {
+		return nil, io.EOF
+	}
+	if r.format != FormatNpy {
+		var header [4]byte
+		if _, err := io.ReadFull(r.r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("vector %d: %v", r.read, err)
+		}
+		if dimension := int(int32(binary.LittleEndian.Uint32(header[:]))); dimension != r.dimension {
+			return nil, fmt.Errorf("vector %d has dimension %d, %d expected", r.read, dimension, r.dimension)
+		}
+	}
+	size := r.dimension * r.element.size()
+	if cap(r.buf) < size {
+		r.buf = make([]byte, size)
+	}
+	r.buf = r.buf[:size]
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("vector %d: %v", r.read, err)
+	}
+	r.read++
+	return r.buf, nil
+}
+
+// ReadFloat returns the next vector as a float vector, io.EOF at the end
+func (r *Reader) ReadFloat() (api.FloatVector, error) {
+	raw, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	vector := make(api.FloatVector, r.dimension)
+	for i := range vector {
+		switch r.element {
+		case elementFloat32:
+			vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+		case elementUint8:
+			vector[i] = float32(raw[i])
+		case elementInt32:
+			vector[i] = float32(int32(binary.LittleEndian.Uint32(raw[i*4:])))
+		}
+	}
+	return vector, nil
+}
+
+// ReadBinary returns the bytes of the next uint8 vector as a binary vector, io.EOF at the end
+func (r *Reader) ReadBinary() (api.BinaryVector, error) {
+	if r.element != elementUint8 {
+		return nil, fmt.Errorf("%s elements could not be read as a binary vector", r.element)
+	}
+	raw, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	return append(api.BinaryVector{}, raw...), nil
+}
+
+// ReadInts returns the next int32 vector, e.g. the ids of the ground truth, io.EOF at the end
+func (r *Reader) ReadInts() ([]int32, error) {
+	if r.element != elementInt32 {
+		return nil, fmt.Errorf("%s elements could not be read as int32", r.element)
+	}
+	raw, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	vector := make([]int32, r.dimension)
+	for i := range vector {
+		vector[i] = int32(binary.LittleEndian.Uint32(raw[i*4:]))
+	}
+	return vector, nil
+}
+
+// Skip skips n vectors, io.EOF is returned if there are fewer
+func (r *Reader) Skip(n int64) error {
+	for i := int64(0); i < n; i++ {
+		if _, err := r.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// vecs.go - read the whole fvecs, bvecs and ivecs files of the ANN benchmark datasets
+
+// Package dataset implements the readers and the writers of the vector dataset formats, such as
+// the fvecs, bvecs and ivecs files of SIFT and GIST and the NumPy npy arrays, and the bulk load
+// of a dataset into a table.
+package dataset
+
+import (
+	"io"
+	"os"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// ReadFvecs reads the float vectors of an fvecs file, each of them is stored as its dimension in
+// a little endian int32 followed by the values in little endian float32. At most limit vectors
+// are read if limit is positive.
+func ReadFvecs(path string, limit int) ([]api.FloatVector, error) {
+	vectors := make([]api.FloatVector, 0)
+	err := readFile(path, FormatFvecs, limit, func(r *Reader) error {
+		vector, err := r.ReadFloat()
+		if err == nil {
+			vectors = append(vectors, vector)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// ReadBvecs reads the uint8 vectors of a bvecs file as float vectors, such as the base vectors of
+// SIFT1B. At most limit vectors are read if limit is positive.
+func ReadBvecs(path string, limit int) ([]api.FloatVector, error) {
+	vectors := make([]api.FloatVector, 0)
+	err := readFile(path, FormatBvecs, limit, func(r *Reader) error {
+		vector, err := r.ReadFloat()
+		if err == nil {
+			vectors = append(vectors, vector)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// ReadIvecs reads the int vectors of an ivecs file, such as the ids of the nearest neighbors of
+// the ground truth files. At most limit vectors are read if limit is positive.
+func ReadIvecs(path string, limit int) ([][]int32, error) {
+	vectors := make([][]int32, 0)
+	err := readFile(path, FormatIvecs, limit, func(r *Reader) error {
+		vector, err := r.ReadInts()
+		if err == nil {
+			vectors = append(vectors, vector)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// readFile calls fn to read each vector of the file of the format until the end or the limit
+func readFile(path string, format Format, limit int, fn func(r *Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r, err := NewReader(file, format)
+	if err != nil {
+		return err
+	}
+	for n := 0; limit <= 0 || n < limit; n++ {
+		if err := fn(r); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// writer.go - write the vectors into the dataset files
+
+package dataset
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// Writer writes vectors of the same dimension into a dataset file. The fvecs files hold float
+// vectors, the bvecs files the bytes of binary vectors and the ivecs files int32 vectors, an npy
+// file holds the type of its first vector. The writer should be closed to flush the vectors.
+type Writer struct {
+	format    Format
+	w         *bufio.Writer
+	dest      io.Writer
+	closer    io.Closer
+	element   elementType
+	dimension int
+	count     int64
+	buf       []byte
+}
+
+// Create creates the dataset file, its format is given by its extension
+func Create(path string) (*Writer, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(file, format)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.closer = file
+	return w, nil
+}
+
+// NewWriter writes the dataset of the format into w, which should be an io.WriteSeeker for npy
+// so that the shape could be written once all the vectors are
+func NewWriter(w io.Writer, format Format) (*Writer, error) {
+	switch format {
+	case FormatFvecs, FormatBvecs, FormatIvecs:
+	case FormatNpy:
+		if _, ok := w.(io.WriteSeeker); !ok {
+			return nil, fmt.Errorf("npy should be written into an io.WriteSeeker")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported dataset format '%s'", format)
+	}
+	return &Writer{
+		format:  format,
+		w:       bufio.NewWriterSize(w, 1<<16),
+		dest:    w,
+		element: vecsElementType(format),
+	}, nil
+}
+
+// Count returns the number of vectors written
+func (w *Writer) Count() int64 {
+	return w.count
+}
+
+// WriteFloat writes a float vector into an fvecs or npy file
+func (w *Writer) WriteFloat(vector api.FloatVector) error {
+	return w.write(elementFloat32, len(vector), func(buf []byte) {
+		for i, v := range vector {
+			binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+		}
+	})
+}
+
+// WriteBinary writes the bytes of a binary vector into a bvecs or npy file
+func (w *Writer) WriteBinary(vector api.BinaryVector) error {
+	return w.write(elementUint8, len(vector), func(buf []byte) {
+		copy(buf, vector)
+	})
+}
+
+// WriteInts writes an int32 vector into an ivecs or npy file
+func (w *Writer) WriteInts(vector []int32) error {
+	return w.write(elementInt32, len(vector), func(buf []byte) {
+		for i, v := range vector {
+			binary.LittleEndian.PutUint32(buf[i*4:], uint32(v))
+		}
+	})
+}
+
+func (w *Writer) write(element elementType, dimension int, encode func(buf []byte)) error {
+	if dimension == 0 {
+		return fmt.Errorf("vector %d is empty", w.count)
+	}
+	if w.count == 0 {
+		if w.format == FormatNpy {
+			w.element = element
+			// a placeholder rewritten by Close
+			if err := w.writeNpyHeader(); err != nil {
+				return err
+			}
+		}
+		w.dimension = dimension
+	}
+	if element != w.element {
+		return fmt.Errorf("%s vectors could not be written into this %s file", element, w.format)
+	}
+	if dimension != w.dimension {
+		return fmt.Errorf("vector %d has dimension %d, %d expected", w.count, dimension, w.dimension)
+	}
+	size := dimension * element.size()
+	if w.format != FormatNpy {
+		size += 4
+	}
+	if cap(w.buf) < size {
+		w.buf = make([]byte, size)
+	}
+	buf := w.buf[:size]
+	if w.format != FormatNpy {
+		binary.LittleEndian.PutUint32(buf, uint32(dimension))
+		buf = buf[4:]
+	}
+	encode(buf)
+	if _, err := w.w.Write(w.buf[:size]); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+func (w *Writer) writeNpyHeader() error {
+	header, err := (&npyHeader{element: w.element, count: w.count, dimension: w.dimension}).encode()
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(header)
+	return err
+}
+
+// Close flushes the vectors, completes the header of an npy file and closes the file opened by
+// Create
+func (w *Writer) Close() error {
+	err := w.close()
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (w *Writer) close() error {
+	if w.format == FormatNpy && w.count == 0 {
+		if err := w.writeNpyHeader(); err != nil {
+			return err
+		}
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if w.format != FormatNpy || w.count == 0 {
+		return nil
+	}
+	seeker := w.dest.(io.WriteSeeker)
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := w.writeNpyHeader(); err != nil {
+		return err
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	_, err := seeker.Seek(0, io.SeekEnd)
+	return err
+}
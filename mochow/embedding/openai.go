@@ -0,0 +1,277 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// openai.go - the embedder calling OpenAI compatible embeddings endpoints
+
+// Package embedding implements embedders which plug into the api package.
+package embedding
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+	"github.com/baidu/mochow-sdk-go/v2/util/log"
+)
+
+const (
+	DefaultMaxBatchSize  = 256
+	DefaultMaxBatchBytes = 1 << 20
+)
+
+// OpenAIEmbedder calls the `/embeddings` endpoint under BaseURL, e.g. "https://api.openai.com/v1"
+// or "http://127.0.0.1:8000/v1" for vLLM. The texts of an Embed call are sent by batches of at
+// most MaxBatchSize texts and MaxBatchBytes bytes, each batch is retried by Retry. A batch
+// rejected with 429 is retried as long as Retry allows another attempt, after the delay of the
+// Retry-After header if any.
+//
+// Dimensions truncates the embeddings to their first Dimensions values and normalizes them
+// again, as done for Matryoshka embeddings. RequestDimensions sends Dimensions to the service
+// instead, which only some models support.
+type OpenAIEmbedder struct {
+	BaseURL           string
+	APIKey            string // sent as bearer token if not empty
+	Model             string
+	Dimensions        int
+	RequestDimensions bool
+	MaxBatchSize      int
+	MaxBatchBytes     int
+	Retry             client.RetryPolicy
+	HTTPClient        *http.Client
+}
+
+type embeddingRequest struct {
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	EncodingFormat string   `json:"encoding_format"`
+	Dimensions     int      `json:"dimensions,omitempty"`
+}
+
+type embeddingData struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+type embeddingResponse struct {
+	Data []embeddingData `json:"data"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// rateLimitError is the error of a request rejected with 429 Too Many Requests
+type rateLimitError struct {
+	*client.BceServiceError
+	retryAfter time.Duration // 0 if the service did not tell
+}
+
+func NewOpenAIEmbedder(baseURL, apiKey, model string) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		BaseURL: baseURL,
+		APIKey:  apiKey,
+		Model:   model,
+	}
+}
+
+// Embed implements api.Embedder, the vectors are api.FloatVector
+func (e *OpenAIEmbedder) Embed(texts []string) ([]api.Vector, error) {
+	embeddings, err := e.EmbedFloat(texts)
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([]api.Vector, len(embeddings))
+	for i, embedding := range embeddings {
+		vectors[i] = embedding
+	}
+	return vectors, nil
+}
+
+// EmbedFloat returns the embeddings of the texts in order
+func (e *OpenAIEmbedder) EmbedFloat(texts []string) ([]api.FloatVector, error) {
+	maxSize := e.MaxBatchSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBatchSize
+	}
+	maxBytes := e.MaxBatchBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBatchBytes
+	}
+	embeddings := make([]api.FloatVector, 0, len(texts))
+	for start := 0; start < len(texts); {
+		end, size := start, 0
+		for end < len(texts) && end-start < maxSize {
+			if end > start && size+len(texts[end]) > maxBytes {
+				break
+			}
+			size += len(texts[end])
+			end++
+		}
+		batch, err := e.embedBatch(texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+		start = end
+	}
+	return embeddings, nil
+}
+
+// embedBatch sends one request for the texts, retrying it as the retry policy allows
+func (e *OpenAIEmbedder) embedBatch(texts []string) ([]api.FloatVector, error) {
+	request := &embeddingRequest{Model: e.Model, Input: texts, EncodingFormat: "float"}
+	if e.RequestDimensions {
+		request.Dimensions = e.Dimensions
+	}
+	body, err := sonic.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	retry := e.Retry
+	if retry == nil {
+		retry = client.DefaultRetryPolicy
+	}
+	for attempts := 0; ; attempts++ {
+		embeddings, err := e.send(body, len(texts))
+		if err == nil {
+			return embeddings, nil
+		}
+		var delay time.Duration
+		if limited, ok := err.(*rateLimitError); ok {
+			// a nil error only asks the policy whether another attempt is allowed
+			if !retry.ShouldRetry(nil, attempts) {
+				return nil, err
+			}
+			delay = limited.retryAfter
+			if delay <= 0 {
+				delay = retry.GetDelayBeforeNextRetryInMillis(err, attempts)
+			}
+		} else {
+			if !retry.ShouldRetry(err, attempts) {
+				return nil, err
+			}
+			delay = retry.GetDelayBeforeNextRetryInMillis(err, attempts)
+		}
+		log.Warnf("embedding request failed: %v, retry for %d time(s)", err, attempts+1)
+		time.Sleep(delay)
+	}
+}
+
+func (e *OpenAIEmbedder) send(body []byte, count int) ([]api.FloatVector, error) {
+	url := strings.TrimRight(e.BaseURL, "/") + "/embeddings"
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", client.DefaultUserAgent)
+	if len(e.APIKey) > 0 {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+	httpClient := e.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: client.DefaultRequestTimeoutInMills * time.Millisecond}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		message := string(data)
+		var errResp errorResponse
+		if sonic.Unmarshal(data, &errResp) == nil && len(errResp.Error.Message) > 0 {
+			message = errResp.Error.Message
+		}
+		serviceErr := client.NewBceServiceError(resp.StatusCode, message, "", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, &rateLimitError{serviceErr, parseRetryAfter(resp.Header.Get("Retry-After"))}
+		}
+		return nil, serviceErr
+	}
+
+	var response embeddingResponse
+	if err := sonic.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Data) != count {
+		return nil, fmt.Errorf("embedding service returned %d embeddings for %d texts", len(response.Data), count)
+	}
+	sort.Slice(response.Data, func(i, j int) bool {
+		return response.Data[i].Index < response.Data[j].Index
+	})
+	embeddings := make([]api.FloatVector, count)
+	for i, d := range response.Data {
+		if d.Index != i {
+			return nil, fmt.Errorf("embedding service returned invalid index %d", d.Index)
+		}
+		embeddings[i] = e.truncate(d.Embedding)
+	}
+	return embeddings, nil
+}
+
+// parseRetryAfter parses the Retry-After header, given in seconds or as a date
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// truncate keeps the first Dimensions values of the embedding and normalizes them to unit length
+func (e *OpenAIEmbedder) truncate(embedding []float32) api.FloatVector {
+	if e.Dimensions <= 0 || len(embedding) <= e.Dimensions {
+		return api.FloatVector(embedding)
+	}
+	truncated := embedding[:e.Dimensions]
+	var norm float64
+	for _, v := range truncated {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range truncated {
+			truncated[i] = float32(float64(truncated[i]) / norm)
+		}
+	}
+	return api.FloatVector(truncated)
+}
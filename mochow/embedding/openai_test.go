@@ -0,0 +1,153 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// openai_test.go - test the OpenAI compatible embedder against a local stub
+
+package embedding
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+	"github.com/baidu/mochow-sdk-go/v2/util/log"
+)
+
+// newStub answers the embedding requests with the embedding [i, len(text), 0, 0] for the i-th
+// text of the request, in reverse order. The first rateLimited requests are rejected with 429.
+func newStub(t *testing.T, rateLimited int32, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("unexpected authorization %q", auth)
+		}
+		if atomic.AddInt32(requests, 1) <= rateLimited {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"rate limited"}}`))
+			return
+		}
+		var request embeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		response := embeddingResponse{}
+		for i := len(request.Input) - 1; i >= 0; i-- {
+			response.Data = append(response.Data, embeddingData{
+				Index:     i,
+				Embedding: []float32{float32(i), float32(len(request.Input[i])), 0, 0},
+			})
+		}
+		json.NewEncoder(w).Encode(&response)
+	}))
+}
+
+func TestEmbedBatchesAndOrder(t *testing.T) {
+	var requests int32
+	stub := newStub(t, 0, &requests)
+	defer stub.Close()
+	embedder := NewOpenAIEmbedder(stub.URL+"/v1/", "key", "m")
+	embedder.MaxBatchSize = 2
+
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	vectors, err := embedder.EmbedFloat(texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+	if len(vectors) != len(texts) {
+		t.Fatalf("expected %d vectors, got %d", len(texts), len(vectors))
+	}
+	for i, vector := range vectors {
+		if int(vector[0]) != i%2 || int(vector[1]) != len(texts[i]) {
+			t.Errorf("vector %d is %v", i, vector)
+		}
+	}
+}
+
+func TestEmbedTruncate(t *testing.T) {
+	var requests int32
+	stub := newStub(t, 0, &requests)
+	defer stub.Close()
+	embedder := NewOpenAIEmbedder(stub.URL+"/v1", "key", "m")
+	embedder.Dimensions = 2
+
+	vectors, err := embedder.EmbedFloat([]string{"abc", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, vector := range vectors {
+		if len(vector) != 2 {
+			t.Fatalf("vector %d has %d dimensions", i, len(vector))
+		}
+		norm := math.Sqrt(float64(vector[0]*vector[0] + vector[1]*vector[1]))
+		if math.Abs(norm-1) > 1e-6 {
+			t.Errorf("vector %d is not normalized: %v", i, vector)
+		}
+	}
+}
+
+func TestEmbedRetryOnRateLimit(t *testing.T) {
+	log.SetLogLevel(log.ERROR)
+	var requests int32
+	stub := newStub(t, 2, &requests)
+	defer stub.Close()
+	embedder := NewOpenAIEmbedder(stub.URL+"/v1", "key", "m")
+	embedder.Retry = client.NewBackOffRetryPolicy(2, 10, 1)
+
+	if _, err := embedder.EmbedFloat([]string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	embedder.Retry = client.NewBackOffRetryPolicy(1, 10, 1)
+	_, err := embedder.EmbedFloat([]string{"a"})
+	if serviceErr, ok := err.(*rateLimitError); !ok || serviceErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected a rate limit error, got %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	cases := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"3", 3 * time.Second, 3 * time.Second},
+		{"-1", 0, 0},
+		{"soon", 0, 0},
+		{date, 59 * time.Minute, time.Hour},
+	}
+	for _, c := range cases {
+		if delay := parseRetryAfter(c.value); delay < c.min || delay > c.max {
+			t.Errorf("Retry-After %q parsed as %v", c.value, delay)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// evaluator.go - measure the recall and the latency of vector search configurations
+
+// Package eval implements the evaluation of the vector searches against exact nearest neighbors,
+// e.g. to tune the parameters of VectorSearchConfig.
+package eval
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// DefaultK is the cut-off of the metrics when Options.K is not set
+const DefaultK = 10
+
+// Options describes the topk searches evaluated: the queries are searched on VectorField of the
+// table with the limit K and the filter. Warmup queries are searched before each configuration
+// without being measured.
+type Options struct {
+	Database    string
+	Table       string
+	VectorField string
+	K           int
+	Filter      string
+	Warmup      int
+}
+
+// Configuration is a named search config, Config nil searches with the default parameters
+type Configuration struct {
+	Name   string
+	Config *api.VectorSearchConfig
+}
+
+// Result holds the metrics of a configuration averaged over the queries, QPS is the throughput
+// of the sequential searches
+type Result struct {
+	Name    string
+	Queries int
+	Recall  float64
+	MRR     float64
+	NDCG    float64
+	Latency LatencyStats
+	QPS     float64
+}
+
+// Report holds the results of a parameter sweep
+type Report struct {
+	K       int
+	Results []*Result
+}
+
+// Evaluator searches the queries with the configurations and compares the results with the
+// ground truth, which is computed once. The tuned configs of the client are not applied, a nil
+// config searching with the defaults of the server.
+type Evaluator struct {
+	client    client.Client
+	options   Options
+	queries   []api.FloatVector
+	truth     [][]string
+	keyFields []string
+}
+
+func NewEvaluator(cli client.Client, options *Options, queries []api.FloatVector,
+	truth GroundTruth) (*Evaluator, error) {
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("queries should not be empty")
+	}
+	if truth == nil {
+		return nil, fmt.Errorf("ground truth should not be nil")
+	}
+	e := &Evaluator{client: untunedClient{cli}, options: *options, queries: queries}
+	if e.options.K <= 0 {
+		e.options.K = DefaultK
+	}
+	schema, err := describeTable(cli, e.options.Database, e.options.Table, e.options.VectorField)
+	if err != nil {
+		return nil, err
+	}
+	e.keyFields = schema.primaryKeys
+	if e.truth, err = truth.Neighbors(queries, e.options.K); err != nil {
+		return nil, err
+	}
+	if len(e.truth) != len(queries) {
+		return nil, fmt.Errorf("ground truth holds %d queries, %d expected", len(e.truth), len(queries))
+	}
+	return e, nil
+}
+
+// untunedClient hides the tuned configs of the client, e.g. a *mochow.Client, so that the
+// configurations are searched as they are
+type untunedClient struct {
+	client.Client
+}
+
+// Options returns the options of the searches, K being defaulted
+func (e *Evaluator) Options() Options {
+	return e.options
+}
+
+// GroundTruth returns the keys of the nearest rows of each query
+func (e *Evaluator) GroundTruth() [][]string {
+	return e.truth
+}
+
+// Evaluate searches all the queries with the configuration
+func (e *Evaluator) Evaluate(configuration Configuration) (*Result, error) {
+	for i := 0; i < e.options.Warmup; i++ {
+		if _, err := e.search(e.queries[i%len(e.queries)], configuration.Config); err != nil {
+			return nil, err
+		}
+	}
+	result := &Result{Name: configuration.Name, Queries: len(e.queries)}
+	latencies := make([]time.Duration, len(e.queries))
+	var elapsed time.Duration
+	for i, query := range e.queries {
+		start := time.Now()
+		keys, err := e.search(query, configuration.Config)
+		if err != nil {
+			return nil, fmt.Errorf("query %d: %v", i, err)
+		}
+		latencies[i] = time.Since(start)
+		elapsed += latencies[i]
+		result.Recall += RecallAtK(keys, e.truth[i], e.options.K)
+		result.MRR += ReciprocalRank(keys, e.truth[i], e.options.K)
+		result.NDCG += NDCGAtK(keys, e.truth[i], e.options.K)
+	}
+	n := float64(len(e.queries))
+	result.Recall /= n
+	result.MRR /= n
+	result.NDCG /= n
+	result.Latency = NewLatencyStats(latencies)
+	if elapsed > 0 {
+		result.QPS = n / elapsed.Seconds()
+	}
+	return result, nil
+}
+
+// Sweep evaluates the configurations one after another, unnamed ones are named by their index
+func (e *Evaluator) Sweep(configurations []Configuration) (*Report, error) {
+	report := &Report{K: e.options.K, Results: make([]*Result, 0, len(configurations))}
+	for i, configuration := range configurations {
+		if len(configuration.Name) == 0 {
+			configuration.Name = fmt.Sprintf("config[%d]", i)
+		}
+		result, err := e.Evaluate(configuration)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", configuration.Name, err)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func (e *Evaluator) search(query api.FloatVector, config *api.VectorSearchConfig) ([]string, error) {
+	request := api.VectorTopkSearchRequest{}.New(e.options.VectorField, query, uint32(e.options.K)).
+		Projections(e.keyFields)
+	if len(e.options.Filter) > 0 {
+		request.Filter(e.options.Filter)
+	}
+	if config != nil {
+		request.Config(config)
+	}
+	result, err := api.VectorSearch(e.client, &api.VectorSearchArgs{
+		Database: e.options.Database,
+		Table:    e.options.Table,
+		Request:  request,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resultKeys(result, e.keyFields), nil
+}
+
+// WriteTable writes the comparison table of the results
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "config\trecall@%d\tmrr\tndcg@%d\tmean\tp50\tp90\tp99\tqps\t\n", r.K, r.K)
+	for _, result := range r.Results {
+		fmt.Fprintf(tw, "%s\t%.4f\t%.4f\t%.4f\t%v\t%v\t%v\t%v\t%.1f\t\n", result.Name,
+			result.Recall, result.MRR, result.NDCG, roundLatency(result.Latency.Mean),
+			roundLatency(result.Latency.P50), roundLatency(result.Latency.P90),
+			roundLatency(result.Latency.P99), result.QPS)
+	}
+	return tw.Flush()
+}
+
+func roundLatency(latency time.Duration) time.Duration {
+	return latency.Round(time.Microsecond)
+}
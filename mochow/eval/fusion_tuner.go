@@ -0,0 +1,324 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// fusion_tuner.go - tune the fusion parameters of hybrid and multivector searches offline
+
+package eval
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// FusionPolicy is the fusion rank policy tuned by TuneFusion
+type FusionPolicy string
+
+const (
+	FusionWeighted FusionPolicy = "weighted" // api.WeightedRank
+	FusionRRF      FusionPolicy = "rrf"      // api.RRFRank
+)
+
+// FusionObjective is the metric maximized by TuneFusion
+type FusionObjective string
+
+const (
+	ObjectiveNDCG   FusionObjective = "ndcg"
+	ObjectiveRecall FusionObjective = "recall"
+)
+
+const (
+	DefaultWeightSteps = 10
+	DefaultMaxRounds   = 10
+)
+
+// DefaultRRFKs are the k tried when FusionTuneArgs.RRFKs is empty
+var DefaultRRFKs = []int64{1, 5, 10, 20, 40, 60, 80, 100, 150, 200}
+
+// LabeledQuery is a query whose legs are collected by api.CollectFusionCandidates, Relevant holds
+// the keys of the rows labeled as relevant, built by api.PrimaryKeyString
+type LabeledQuery struct {
+	Candidates *api.FusionCandidates
+	Relevant   []string
+}
+
+// FusionTuneArgs describes the search of TuneFusion. The weights of WeightedRank are searched on
+// a grid of WeightSteps steps in [0, 1]: exhaustively for two legs, by coordinate ascent of at
+// most MaxRounds rounds from equal weights for more legs. The k of RRFRank are searched among
+// RRFKs. The fused rows are cut at K, and the relevance of the rows is min-max normalized per
+// leg with NormalizeScores as FusionSearch does.
+type FusionTuneArgs struct {
+	Policy          FusionPolicy
+	Objective       FusionObjective // ObjectiveNDCG by default
+	K               int
+	NormalizeScores bool
+	WeightSteps     int
+	MaxRounds       int
+	RRFKs           []int64
+}
+
+// FusionTrial holds the metrics of fusion parameters averaged over the queries, Weights is set
+// for WeightedRank and RRFK for RRFRank, none of them for the rank of the requests
+type FusionTrial struct {
+	Weights []float64
+	RRFK    int64
+	NDCG    float64
+	Recall  float64
+	MRR     float64
+}
+
+// FusionTuneResult holds the best parameters, the metrics of the rank of the requests as the
+// baseline and all the trials in their order
+type FusionTuneResult struct {
+	K         int
+	Objective FusionObjective
+	Baseline  FusionTrial
+	Best      FusionTrial
+	Trials    []FusionTrial
+}
+
+func TuneFusion(queries []LabeledQuery, args *FusionTuneArgs) (*FusionTuneResult, error) {
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("queries should not be empty")
+	}
+	legs := 0
+	for i, query := range queries {
+		if query.Candidates == nil {
+			return nil, fmt.Errorf("candidates of query %d should not be nil", i)
+		}
+		if i == 0 {
+			legs = len(query.Candidates.Legs)
+		} else if len(query.Candidates.Legs) != legs {
+			return nil, fmt.Errorf("query %d has %d legs, %d expected", i, len(query.Candidates.Legs), legs)
+		}
+	}
+	objective := args.Objective
+	if len(objective) == 0 {
+		objective = ObjectiveNDCG
+	}
+	if objective != ObjectiveNDCG && objective != ObjectiveRecall {
+		return nil, fmt.Errorf("unsupported objective '%s'", objective)
+	}
+	k := args.K
+	if k <= 0 {
+		k = DefaultK
+	}
+	tuner := &fusionTuner{
+		queries:   queries,
+		objective: objective,
+		k:         k,
+		normalize: args.NormalizeScores,
+		tried:     make(map[string]bool),
+	}
+	var err error
+	tuner.result.Baseline, err = tuner.evaluate(func(c *api.FusionCandidates) ([]string, error) {
+		return c.Fuse(nil, tuner.normalize, k)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch args.Policy {
+	case FusionWeighted:
+		err = tuner.tuneWeights(legs, args)
+	case FusionRRF:
+		err = tuner.tuneRRFK(args)
+	default:
+		return nil, fmt.Errorf("unsupported fusion policy '%s'", args.Policy)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tuner.result.K = k
+	tuner.result.Objective = objective
+	return &tuner.result, nil
+}
+
+type fusionTuner struct {
+	queries   []LabeledQuery
+	objective FusionObjective
+	k         int
+	normalize bool
+	tried     map[string]bool
+	result    FusionTuneResult
+	found     bool
+}
+
+func (t *fusionTuner) tuneWeights(legs int, args *FusionTuneArgs) error {
+	steps := args.WeightSteps
+	if steps <= 0 {
+		steps = DefaultWeightSteps
+	}
+	grid := make([]float64, steps+1)
+	for i := range grid {
+		grid[i] = float64(i) / float64(steps)
+	}
+	if legs == 2 {
+		for i := range grid {
+			if _, err := t.tryWeights([]float64{grid[i], grid[steps-i]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	rounds := args.MaxRounds
+	if rounds <= 0 {
+		rounds = DefaultMaxRounds
+	}
+	weights := make([]float64, legs)
+	for i := range weights {
+		weights[i] = 1 / float64(legs)
+	}
+	if _, err := t.tryWeights(weights); err != nil {
+		return err
+	}
+	for round := 0; round < rounds; round++ {
+		improved := false
+		for leg := 0; leg < legs; leg++ {
+			for _, w := range grid {
+				candidate := append([]float64{}, t.result.Best.Weights...)
+				candidate[leg] = w
+				better, err := t.tryWeights(candidate)
+				if err != nil {
+					return err
+				}
+				improved = improved || better
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return nil
+}
+
+func (t *fusionTuner) tuneRRFK(args *FusionTuneArgs) error {
+	ks := args.RRFKs
+	if len(ks) == 0 {
+		ks = DefaultRRFKs
+	}
+	for _, k := range ks {
+		if k <= 0 {
+			return fmt.Errorf("k of RRFRank should be positive, got %d", k)
+		}
+		rank := api.RRFRank{}.New(k)
+		trial, err := t.evaluate(func(c *api.FusionCandidates) ([]string, error) {
+			return c.Fuse(rank, t.normalize, t.k)
+		})
+		if err != nil {
+			return err
+		}
+		trial.RRFK = k
+		t.record(trial)
+	}
+	return nil
+}
+
+// tryWeights evaluates the weights unless all zero or already tried, and tells whether they
+// improved the best trial
+func (t *fusionTuner) tryWeights(weights []float64) (bool, error) {
+	key := fmt.Sprint(weights)
+	zero := true
+	for _, w := range weights {
+		zero = zero && w == 0
+	}
+	if zero || t.tried[key] {
+		return false, nil
+	}
+	t.tried[key] = true
+	rank := api.WeightedRank{}.New(weights)
+	trial, err := t.evaluate(func(c *api.FusionCandidates) ([]string, error) {
+		return c.Fuse(rank, t.normalize, t.k)
+	})
+	if err != nil {
+		return false, err
+	}
+	trial.Weights = weights
+	return t.record(trial), nil
+}
+
+// record appends the trial and tells whether it is strictly better than the best one
+func (t *fusionTuner) record(trial FusionTrial) bool {
+	t.result.Trials = append(t.result.Trials, trial)
+	if !t.found || t.value(trial) > t.value(t.result.Best) {
+		t.result.Best = trial
+		t.found = true
+		return true
+	}
+	return false
+}
+
+func (t *fusionTuner) value(trial FusionTrial) float64 {
+	if t.objective == ObjectiveRecall {
+		return trial.Recall
+	}
+	return trial.NDCG
+}
+
+// evaluate fuses the candidates of all the queries by fuse and averages the metrics
+func (t *fusionTuner) evaluate(fuse func(c *api.FusionCandidates) ([]string, error)) (FusionTrial, error) {
+	trial := FusionTrial{}
+	for i, query := range t.queries {
+		keys, err := fuse(query.Candidates)
+		if err != nil {
+			return trial, fmt.Errorf("query %d: %v", i, err)
+		}
+		trial.NDCG += NDCGAtK(keys, query.Relevant, t.k)
+		trial.Recall += RecallAtK(keys, query.Relevant, t.k)
+		trial.MRR += ReciprocalRank(keys, query.Relevant, t.k)
+	}
+	n := float64(len(t.queries))
+	trial.NDCG /= n
+	trial.Recall /= n
+	trial.MRR /= n
+	return trial, nil
+}
+
+// WriteTable writes the baseline and the trials from the best to the worst
+func (r *FusionTuneResult) WriteTable(w io.Writer) error {
+	trials := append([]FusionTrial{}, r.Trials...)
+	sort.SliceStable(trials, func(i, j int) bool {
+		if r.Objective == ObjectiveRecall {
+			return trials[i].Recall > trials[j].Recall
+		}
+		return trials[i].NDCG > trials[j].NDCG
+	})
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "params\tndcg@%d\trecall@%d\tmrr\t\n", r.K, r.K)
+	fmt.Fprintf(tw, "request\t%.4f\t%.4f\t%.4f\t\n", r.Baseline.NDCG, r.Baseline.Recall, r.Baseline.MRR)
+	for _, trial := range trials {
+		fmt.Fprintf(tw, "%s\t%.4f\t%.4f\t%.4f\t\n", trial.params(), trial.NDCG, trial.Recall, trial.MRR)
+	}
+	return tw.Flush()
+}
+
+func (t FusionTrial) params() string {
+	if len(t.Weights) > 0 {
+		weights := make([]string, len(t.Weights))
+		for i, w := range t.Weights {
+			weights[i] = strconv.FormatFloat(w, 'f', -1, 64)
+		}
+		return "weights=" + strings.Join(weights, ",")
+	}
+	if t.RRFK > 0 {
+		return "k=" + strconv.FormatInt(t.RRFK, 10)
+	}
+	return "request"
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// ground_truth.go - the exact nearest neighbors the searches are evaluated against
+
+package eval
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/dataset"
+)
+
+// DefaultIvecsKeyField is the primary key holding the ids of an ivecs ground truth file
+const DefaultIvecsKeyField = "id"
+
+// GroundTruth returns the keys of the k nearest rows of each query, the closest first. The keys
+// are built by api.PrimaryKeyString from the primary key of the rows.
+type GroundTruth interface {
+	Neighbors(queries []api.FloatVector, k int) ([][]string, error)
+}
+
+// BruteForce scans all the rows matching Filter and computes their distances to the queries on
+// the client side, MetricType defaults to the metric of the vector index of the field
+type BruteForce struct {
+	Client      client.Client
+	Database    string
+	Table       string
+	VectorField string
+	MetricType  api.MetricType
+	Filter      string
+	BatchSize   uint64 // rows per select, defaults to api.DefaultSelectBatchSize
+}
+
+func (b *BruteForce) Neighbors(queries []api.FloatVector, k int) ([][]string, error) {
+	schema, err := describeTable(b.Client, b.Database, b.Table, b.VectorField)
+	if err != nil {
+		return nil, err
+	}
+	metric := b.MetricType
+	if len(metric) == 0 {
+		metric = schema.metricType
+	}
+	if len(metric) == 0 {
+		return nil, fmt.Errorf("metric type of field '%s' is unknown, it should be given", b.VectorField)
+	}
+	nearest := make([]neighborHeap, len(queries))
+	iterator := api.NewSelectIterator(b.Client, &api.SelectRowArgs{
+		Database:    b.Database,
+		Table:       b.Table,
+		Filter:      b.Filter,
+		Limit:       b.BatchSize,
+		Projections: append(append([]string{}, schema.primaryKeys...), b.VectorField),
+	})
+	defer iterator.Close()
+	for {
+		rows, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if rows == nil {
+			break
+		}
+		keys := make([]string, len(rows))
+		vectors := make([]api.FloatVector, len(rows))
+		for j, row := range rows {
+			if vectors[j], err = api.RowFloatVector(row, b.VectorField); err != nil {
+				return nil, err
+			}
+			keys[j] = rowKey(row, schema.primaryKeys)
+		}
+		for i, query := range queries {
+			distances, err := api.BatchDistance(metric, query, vectors)
+			if err != nil {
+				return nil, err
+			}
+			for j, distance := range distances {
+				nearest[i].push(neighbor{key: keys[j], score: api.DistanceToScore(metric, distance)}, k)
+			}
+		}
+	}
+	neighbors := make([][]string, len(queries))
+	for i := range nearest {
+		neighbors[i] = nearest[i].sortedKeys()
+	}
+	return neighbors, nil
+}
+
+// FlatTable searches the queries on a copy of the table indexed by FLAT, whose results are exact
+type FlatTable struct {
+	Client      client.Client
+	Database    string
+	Table       string
+	VectorField string
+	Filter      string
+}
+
+func (f *FlatTable) Neighbors(queries []api.FloatVector, k int) ([][]string, error) {
+	schema, err := describeTable(f.Client, f.Database, f.Table, f.VectorField)
+	if err != nil {
+		return nil, err
+	}
+	neighbors := make([][]string, len(queries))
+	for i, query := range queries {
+		request := api.VectorTopkSearchRequest{}.New(f.VectorField, query, uint32(k)).
+			Projections(schema.primaryKeys)
+		if len(f.Filter) > 0 {
+			request.Filter(f.Filter)
+		}
+		result, err := api.VectorSearch(untunedClient{f.Client}, &api.VectorSearchArgs{
+			Database: f.Database,
+			Table:    f.Table,
+			Request:  request,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("query %d: %v", i, err)
+		}
+		neighbors[i] = resultKeys(result, schema.primaryKeys)
+	}
+	return neighbors, nil
+}
+
+// IvecsFile reads the ids of the nearest neighbors from an ivecs file, as shipped with the ANN
+// benchmark datasets. The i-th vector of the file holds the neighbors of the i-th query, and the
+// ids are the values of the integer primary key KeyField, which defaults to DefaultIvecsKeyField.
+type IvecsFile struct {
+	Path     string
+	KeyField string
+}
+
+func (f *IvecsFile) Neighbors(queries []api.FloatVector, k int) ([][]string, error) {
+	keyField := f.KeyField
+	if len(keyField) == 0 {
+		keyField = DefaultIvecsKeyField
+	}
+	ids, err := dataset.ReadIvecs(f.Path, len(queries))
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) < len(queries) {
+		return nil, fmt.Errorf("%s holds %d queries, %d expected", f.Path, len(ids), len(queries))
+	}
+	neighbors := make([][]string, len(queries))
+	for i := range queries {
+		n := len(ids[i])
+		if n > k {
+			n = k
+		}
+		neighbors[i] = make([]string, n)
+		for j := 0; j < n; j++ {
+			neighbors[i][j] = api.PrimaryKeyString(map[string]interface{}{keyField: int64(ids[i][j])})
+		}
+	}
+	return neighbors, nil
+}
+
+type tableSchema struct {
+	primaryKeys []string
+	metricType  api.MetricType
+}
+
+// describeTable returns the primary key of the table and the metric of the vector field
+func describeTable(cli client.Client, database, table, vectorField string) (*tableSchema, error) {
+	result, err := api.DescTable(cli, &api.DescTableArgs{Database: database, Table: table})
+	if err != nil {
+		return nil, err
+	}
+	if result.Table == nil || result.Table.Schema == nil {
+		return nil, fmt.Errorf("schema of table '%s' is not available", table)
+	}
+	schema := &tableSchema{primaryKeys: make([]string, 0)}
+	for _, field := range result.Table.Schema.Fields {
+		if field.PrimaryKey {
+			schema.primaryKeys = append(schema.primaryKeys, field.FieldName)
+		}
+	}
+	if len(schema.primaryKeys) == 0 {
+		return nil, fmt.Errorf("primary key of table '%s' is unknown", table)
+	}
+	schema.metricType = api.IndexMetricType(result.Table.Schema, vectorField)
+	return schema, nil
+}
+
+func rowKey(row api.Row, keyFields []string) string {
+	values := make(map[string]interface{}, len(keyFields))
+	for _, field := range keyFields {
+		values[field] = row.Fields[field]
+	}
+	return api.PrimaryKeyString(values)
+}
+
+func resultKeys(result *api.SearchResult, keyFields []string) []string {
+	keys := make([]string, 0)
+	if result.Rows == nil {
+		return keys
+	}
+	for _, row := range result.Rows.Rows {
+		keys = append(keys, rowKey(row.Row, keyFields))
+	}
+	return keys
+}
+
+type neighbor struct {
+	key   string
+	score float64 // larger is closer
+}
+
+// neighborHeap keeps the k closest neighbors with the farthest one on top
+type neighborHeap []neighbor
+
+func (h neighborHeap) Len() int            { return len(h) }
+func (h neighborHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h neighborHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *neighborHeap) Push(x interface{}) { *h = append(*h, x.(neighbor)) }
+func (h *neighborHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+func (h *neighborHeap) push(n neighbor, k int) {
+	if h.Len() < k {
+		heap.Push(h, n)
+	} else if h.Len() > 0 && n.score > (*h)[0].score {
+		(*h)[0] = n
+		heap.Fix(h, 0)
+	}
+}
+
+func (h neighborHeap) sortedKeys() []string {
+	sorted := append(neighborHeap{}, h...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].score > sorted[j].score })
+	keys := make([]string, len(sorted))
+	for i, n := range sorted {
+		keys[i] = n.key
+	}
+	return keys
+}
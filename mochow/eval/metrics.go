@@ -0,0 +1,132 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// metrics.go - the retrieval quality and latency metrics
+
+package eval
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// RecallAtK returns the number of relevant keys found in the first k results divided by the
+// number of relevant keys capped at k, 1 if there is no relevant key
+func RecallAtK(results, relevant []string, k int) float64 {
+	if len(relevant) == 0 {
+		return 1
+	}
+	set := keySet(relevant)
+	found := 0
+	for _, key := range truncate(results, k) {
+		if set[key] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(truncate(relevant, k)))
+}
+
+// ReciprocalRank returns the inverse of the rank of the first relevant result, 0 if none of the
+// first k results is relevant
+func ReciprocalRank(results, relevant []string, k int) float64 {
+	set := keySet(relevant)
+	for i, key := range truncate(results, k) {
+		if set[key] {
+			return 1 / float64(i+1)
+		}
+	}
+	return 0
+}
+
+// NDCGAtK returns the normalized discounted cumulative gain of the first k results, each
+// relevant key having a gain of 1 and the ideal ranking holding at most k of them, 1 if there
+// is no relevant key
+func NDCGAtK(results, relevant []string, k int) float64 {
+	if len(relevant) == 0 {
+		return 1
+	}
+	set := keySet(relevant)
+	var dcg, idcg float64
+	for i, key := range truncate(results, k) {
+		if set[key] {
+			dcg += 1 / math.Log2(float64(i+2))
+		}
+	}
+	for i := range truncate(relevant, k) {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+	return dcg / idcg
+}
+
+// LatencyStats summarizes the latencies of the searches
+type LatencyStats struct {
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P95  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+// NewLatencyStats computes the statistics of the latencies by the nearest rank percentiles
+func NewLatencyStats(latencies []time.Duration) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, latency := range sorted {
+		total += latency
+	}
+	return LatencyStats{
+		Mean: total / time.Duration(len(sorted)),
+		P50:  Percentile(sorted, 50),
+		P90:  Percentile(sorted, 90),
+		P95:  Percentile(sorted, 95),
+		P99:  Percentile(sorted, 99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// Percentile returns the nearest rank percentile of the sorted latencies
+func Percentile(sorted []time.Duration, percent float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(percent / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func truncate(keys []string, k int) []string {
+	if k > 0 && len(keys) > k {
+		return keys[:k]
+	}
+	return keys
+}
+
+func keySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
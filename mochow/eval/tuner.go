@@ -0,0 +1,168 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// tuner.go - find the cheapest search parameter reaching a target recall
+
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// TuneParameter is the parameter of VectorSearchConfig searched by Tune
+type TuneParameter string
+
+const (
+	TuneEf                TuneParameter = "ef"                // HNSW
+	TuneSearchCoarseCount TuneParameter = "searchCoarseCount" // PUCK
+)
+
+// DefaultTuneMax is the largest value tried when TuneArgs.Max is not set
+const DefaultTuneMax = 1024
+
+// TuneArgs searches the smallest value of Parameter in [Min, Max] whose recall at the K of the
+// evaluator reaches TargetRecall, e.g. 0.95. Min defaults to K for ef and to 1 otherwise. The
+// recall is assumed to grow with the parameter, as the latency does. If MaxP99Latency is set,
+// the value found should not exceed it.
+type TuneArgs struct {
+	Parameter     TuneParameter
+	TargetRecall  float64
+	Min           uint32
+	Max           uint32
+	MaxP99Latency time.Duration
+}
+
+// TuneTrial is the evaluation of a value of the parameter
+type TuneTrial struct {
+	Value  uint32
+	Result *Result
+}
+
+// TuneResult holds the recommended config and the trials sorted by value
+type TuneResult struct {
+	Config *api.TunedSearchConfig
+	Best   *TuneTrial
+	Trials []*TuneTrial
+}
+
+// Report returns the trials as a report, e.g. to print the comparison table
+func (r *TuneResult) Report(k int) *Report {
+	report := &Report{K: k, Results: make([]*Result, len(r.Trials))}
+	for i, trial := range r.Trials {
+		report.Results[i] = trial.Result
+	}
+	return report
+}
+
+// Tune binary searches the parameter with the evaluator. When the target is not reached, or is
+// only reached above MaxP99Latency, an error is returned together with the trials.
+func Tune(e *Evaluator, args *TuneArgs) (*TuneResult, error) {
+	if args.Parameter != TuneEf && args.Parameter != TuneSearchCoarseCount {
+		return nil, fmt.Errorf("unsupported tune parameter '%s'", args.Parameter)
+	}
+	if args.TargetRecall <= 0 || args.TargetRecall > 1 {
+		return nil, fmt.Errorf("target recall should be in (0, 1]")
+	}
+	options := e.Options()
+	low, high := args.Min, args.Max
+	if low == 0 {
+		low = 1
+		if args.Parameter == TuneEf {
+			low = uint32(options.K)
+		}
+	}
+	if high == 0 {
+		high = DefaultTuneMax
+	}
+	if low > high {
+		return nil, fmt.Errorf("min %d should not be greater than max %d", low, high)
+	}
+
+	trials := make(map[uint32]*TuneTrial)
+	evaluate := func(value uint32) (*TuneTrial, error) {
+		if trial, ok := trials[value]; ok {
+			return trial, nil
+		}
+		config := api.VectorSearchConfig{}.New()
+		if args.Parameter == TuneEf {
+			config.Ef(value)
+		} else {
+			config.SearchCoarseCount(value)
+		}
+		result, err := e.Evaluate(Configuration{
+			Name:   fmt.Sprintf("%s=%d", args.Parameter, value),
+			Config: config,
+		})
+		if err != nil {
+			return nil, err
+		}
+		trial := &TuneTrial{Value: value, Result: result}
+		trials[value] = trial
+		return trial, nil
+	}
+	sortedTrials := func() []*TuneTrial {
+		sorted := make([]*TuneTrial, 0, len(trials))
+		for _, trial := range trials {
+			sorted = append(sorted, trial)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Value < sorted[j].Value })
+		return sorted
+	}
+
+	best, err := evaluate(high)
+	if err != nil {
+		return nil, err
+	}
+	if best.Result.Recall < args.TargetRecall {
+		return &TuneResult{Trials: sortedTrials()}, fmt.Errorf("recall %.4f of %s=%d is below the target %.4f",
+			best.Result.Recall, args.Parameter, high, args.TargetRecall)
+	}
+	// invariant: high reaches the target, the values below low do not
+	for low < high {
+		middle := low + (high-low)/2
+		trial, err := evaluate(middle)
+		if err != nil {
+			return nil, err
+		}
+		if trial.Result.Recall >= args.TargetRecall {
+			high, best = middle, trial
+		} else {
+			low = middle + 1
+		}
+	}
+
+	result := &TuneResult{Best: best, Trials: sortedTrials()}
+	if args.MaxP99Latency > 0 && best.Result.Latency.P99 > args.MaxP99Latency {
+		return result, fmt.Errorf("p99 latency %v of %s=%d exceeds %v", best.Result.Latency.P99,
+			args.Parameter, best.Value, args.MaxP99Latency)
+	}
+	result.Config = &api.TunedSearchConfig{
+		Database:     options.Database,
+		Table:        options.Table,
+		VectorField:  options.VectorField,
+		K:            options.K,
+		TargetRecall: args.TargetRecall,
+		Recall:       best.Result.Recall,
+	}
+	if args.Parameter == TuneEf {
+		result.Config.Ef = best.Value
+	} else {
+		result.Config.SearchCoarseCount = best.Value
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// compress.go - the compressions of the exported files
+
+package export
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compression is the compression of the exported files, the pages of the parquet files being
+// compressed instead of the whole files
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// compressWriter compresses into an underlying writer, Flush writes the data compressed so far
+// and Close flushes the data without closing the underlying writer
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressor returns a writer compressing into w
+type compressor func(w io.Writer) (compressWriter, error)
+
+// getCompressor returns the compressor of the compression, nil if there is no compression
+func getCompressor(compression Compression) (compressor, error) {
+	switch compression {
+	case CompressionNone:
+		return nil, nil
+	case CompressionGzip:
+		return func(w io.Writer) (compressWriter, error) {
+			return gzip.NewWriter(w), nil
+		}, nil
+	case CompressionZstd:
+		return func(w io.Writer) (compressWriter, error) {
+			return newZstdWriter(w), nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported compression '%s'", compression)
+}
+
+func (c Compression) extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// parquetCodec returns the compression codec of the parquet pages
+func (c Compression) parquetCodec() int32 {
+	switch c {
+	case CompressionGzip:
+		return 2
+	case CompressionZstd:
+		return 6
+	}
+	return 0
+}
@@ -0,0 +1,337 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// exporter.go - export the rows of a table into files
+
+// Package export implements the export of the rows of a table into JSONL, CSV or parquet files
+// for offline analytics. The rows are paged through and written as they come, so that a table
+// larger than the memory could be exported.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+const DefaultRowGroupSize = 10000
+
+// Options describes an export. The rows matching Filter, all of them by default, are read
+// PageSize at a time with the fields of Projections, all the fields of the table by default.
+//
+// The files are written into Dir, named after Prefix, the table by default, followed by their
+// sequence number, e.g. "t-00000.jsonl.gz", and by the manifest "t-manifest.json". A new file
+// is started once MaxFileSize bytes are written if MaxFileSize is positive, so that a file
+// exceeds MaxFileSize by a row at most. The size of a parquet file is checked after each of its
+// row groups of RowGroupSize rows instead.
+type Options struct {
+	Database        string
+	Table           string
+	Projections     []string
+	Filter          string
+	ReadConsistency api.ReadConsistency
+	PageSize        uint64
+	Format          Format
+	Compression     Compression
+	Dir             string
+	Prefix          string
+	MaxFileSize     int64
+	RowGroupSize    int
+}
+
+// ManifestFile is a file written by an export
+type ManifestFile struct {
+	Name  string `json:"name"`
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Manifest describes the files written by an export, Columns being the fields exported
+type Manifest struct {
+	Database    string           `json:"database"`
+	Table       string           `json:"table"`
+	Filter      string           `json:"filter,omitempty"`
+	Format      Format           `json:"format"`
+	Compression Compression      `json:"compression,omitempty"`
+	Columns     []string         `json:"columns"`
+	Schema      *api.TableSchema `json:"schema"`
+	Rows        int64            `json:"rows"`
+	Files       []ManifestFile   `json:"files"`
+	StartTime   time.Time        `json:"startTime"`
+	EndTime     time.Time        `json:"endTime"`
+}
+
+// ReadManifest reads the manifest written by an export
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+type exporter struct {
+	options  Options
+	fields   []*api.FieldSchema
+	manifest *Manifest
+	current  *outputFile
+}
+
+// outputFile is the file being written, its bytes are counted below the compression. text is
+// the writer of a JSONL or CSV file, whose rows encoded up to flushed are compressed into the
+// file.
+type outputFile struct {
+	file     *os.File
+	counter  *countingWriter
+	compress compressWriter
+	writer   rowWriter
+	text     textWriter
+	flushed  int64
+	info     ManifestFile
+}
+
+// full tells whether the file reached the size. A parquet file is only checked once its row
+// group is written and an uncompressed text file is as large as its rows. The rows of a
+// compressed text file are flushed through the compression to get its size, once the rows not
+// flushed could fill the space left, as the compression hardly makes data larger.
+func (o *outputFile) full(size int64) (bool, error) {
+	if o.text == nil {
+		p := o.writer.(*parquetWriter)
+		return p.rows == 0 && o.counter.n >= size, nil
+	}
+	if o.compress == nil {
+		return o.text.written() >= size, nil
+	}
+	if o.counter.n+o.text.written()-o.flushed < size {
+		return false, nil
+	}
+	if err := o.text.flush(); err != nil {
+		return false, err
+	}
+	if err := o.compress.Flush(); err != nil {
+		return false, err
+	}
+	o.flushed = o.text.written()
+	return o.counter.n >= size, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Export exports the rows of the table and writes the manifest, which is returned. On failure
+// the files already written are listed in the returned manifest along with the error.
+func Export(cli client.Client, options *Options) (*Manifest, error) {
+	e := &exporter{options: *options}
+	opts := &e.options
+	if len(opts.Format) == 0 {
+		opts.Format = FormatJSONL
+	}
+	if len(opts.Dir) == 0 {
+		opts.Dir = "."
+	}
+	if len(opts.Prefix) == 0 {
+		opts.Prefix = opts.Table
+	}
+	if opts.RowGroupSize <= 0 {
+		opts.RowGroupSize = DefaultRowGroupSize
+	}
+	switch opts.Format {
+	case FormatJSONL, FormatCSV, FormatParquet:
+	default:
+		return nil, fmt.Errorf("unsupported format '%s'", opts.Format)
+	}
+	if _, err := getCompressor(opts.Compression); err != nil {
+		return nil, err
+	}
+	desc, err := api.DescTable(cli, &api.DescTableArgs{Database: opts.Database, Table: opts.Table})
+	if err != nil {
+		return nil, err
+	}
+	if desc.Table == nil || desc.Table.Schema == nil {
+		return nil, fmt.Errorf("schema of table '%s' is not available", opts.Table)
+	}
+	e.manifest = &Manifest{
+		Database:    opts.Database,
+		Table:       opts.Table,
+		Filter:      opts.Filter,
+		Format:      opts.Format,
+		Compression: opts.Compression,
+		Schema:      desc.Table.Schema,
+		Files:       make([]ManifestFile, 0),
+		StartTime:   time.Now(),
+	}
+	if err := e.selectFields(desc.Table.Schema); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := e.export(cli); err != nil {
+		if e.current != nil {
+			e.current.file.Close()
+		}
+		return e.manifest, err
+	}
+	e.manifest.EndTime = time.Now()
+	data, err := json.MarshalIndent(e.manifest, "", "  ")
+	if err != nil {
+		return e.manifest, err
+	}
+	path := filepath.Join(opts.Dir, opts.Prefix+"-manifest.json")
+	return e.manifest, ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func (e *exporter) selectFields(schema *api.TableSchema) error {
+	byName := make(map[string]*api.FieldSchema, len(schema.Fields))
+	for i := range schema.Fields {
+		byName[schema.Fields[i].FieldName] = &schema.Fields[i]
+	}
+	names := e.options.Projections
+	if len(names) == 0 {
+		for _, field := range schema.Fields {
+			names = append(names, field.FieldName)
+		}
+	}
+	for _, name := range names {
+		field, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("field '%s' does not exist", name)
+		}
+		e.fields = append(e.fields, field)
+		e.manifest.Columns = append(e.manifest.Columns, name)
+	}
+	return nil
+}
+
+func (e *exporter) export(cli client.Client) error {
+	iterator := api.NewSelectIterator(cli, &api.SelectRowArgs{
+		Database:        e.options.Database,
+		Table:           e.options.Table,
+		Filter:          e.options.Filter,
+		Limit:           e.options.PageSize,
+		Projections:     e.manifest.Columns,
+		ReadConsistency: e.options.ReadConsistency,
+	})
+	defer iterator.Close()
+	// the first file is written even if no row matches
+	if err := e.open(); err != nil {
+		return err
+	}
+	for {
+		rows, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+		if rows == nil {
+			break
+		}
+		for _, row := range rows {
+			if e.current == nil {
+				if err := e.open(); err != nil {
+					return err
+				}
+			}
+			if err := e.current.writer.write(row.Fields); err != nil {
+				return fmt.Errorf("%s: %v", e.current.info.Name, err)
+			}
+			e.current.info.Rows++
+			if e.options.MaxFileSize <= 0 {
+				continue
+			}
+			full, err := e.current.full(e.options.MaxFileSize)
+			if err != nil {
+				return fmt.Errorf("%s: %v", e.current.info.Name, err)
+			}
+			if full {
+				if err := e.close(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if e.current != nil {
+		return e.close()
+	}
+	return nil
+}
+
+func (e *exporter) open() error {
+	opts := &e.options
+	name := fmt.Sprintf("%s-%05d%s", opts.Prefix, len(e.manifest.Files), opts.Format.extension())
+	if opts.Format != FormatParquet {
+		name += opts.Compression.extension()
+	}
+	file, err := os.Create(filepath.Join(opts.Dir, name))
+	if err != nil {
+		return err
+	}
+	out := &outputFile{file: file, counter: &countingWriter{w: file}, info: ManifestFile{Name: name}}
+	e.current = out
+	var w io.Writer = out.counter
+	if opts.Format == FormatParquet {
+		out.writer, err = newParquetWriter(w, e.fields, opts.Compression, opts.RowGroupSize)
+		return err
+	}
+	if compressor, _ := getCompressor(opts.Compression); compressor != nil {
+		if out.compress, err = compressor(w); err != nil {
+			return err
+		}
+		w = out.compress
+	}
+	if opts.Format == FormatCSV {
+		out.text, err = newCSVWriter(w, e.manifest.Columns)
+	} else {
+		out.text = newJSONLWriter(w)
+	}
+	out.writer = out.text
+	return err
+}
+
+func (e *exporter) close() error {
+	out := e.current
+	e.current = nil
+	err := out.writer.close()
+	if out.compress != nil && err == nil {
+		err = out.compress.Close()
+	}
+	if closeErr := out.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", out.info.Name, err)
+	}
+	out.info.Bytes = out.counter.n
+	e.manifest.Files = append(e.manifest.Files, out.info)
+	e.manifest.Rows += out.info.Rows
+	return nil
+}
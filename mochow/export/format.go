@@ -0,0 +1,147 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// format.go - write the rows as JSONL or CSV
+
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// Format is the format of the exported files
+type Format string
+
+const (
+	FormatJSONL   Format = "jsonl"   // a JSON object per row
+	FormatCSV     Format = "csv"     // a header line naming the columns followed by a line per row
+	FormatParquet Format = "parquet" // a parquet file with a column per field
+)
+
+func (f Format) extension() string {
+	return "." + string(f)
+}
+
+// rowWriter writes the rows into a file, close flushes them without closing the file
+type rowWriter interface {
+	write(fields map[string]interface{}) error
+	close() error
+}
+
+// textWriter is a rowWriter buffering the encoded rows, written counts the bytes of the rows
+// encoded so far, flushed or not
+type textWriter interface {
+	rowWriter
+	written() int64
+	flush() error
+}
+
+type jsonlWriter struct {
+	w     *bufio.Writer
+	bytes int64
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	return &jsonlWriter{w: bufio.NewWriterSize(w, 1<<16)}
+}
+
+func (j *jsonlWriter) write(fields map[string]interface{}) error {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	j.w.Write(data)
+	j.bytes += int64(len(data)) + 1
+	return j.w.WriteByte('\n')
+}
+
+func (j *jsonlWriter) written() int64 {
+	return j.bytes
+}
+
+func (j *jsonlWriter) flush() error {
+	return j.w.Flush()
+}
+
+func (j *jsonlWriter) close() error {
+	return j.w.Flush()
+}
+
+// csvWriter writes a column per field, the vectors and the arrays as JSON and the nulls as
+// empty cells. Each line is encoded into line before being buffered, to count its bytes.
+type csvWriter struct {
+	w       *bufio.Writer
+	line    bytes.Buffer
+	encoder *csv.Writer
+	bytes   int64
+	columns []string
+	cells   []string
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	c := &csvWriter{w: bufio.NewWriterSize(w, 1<<16), columns: columns, cells: make([]string, len(columns))}
+	c.encoder = csv.NewWriter(&c.line)
+	return c, c.writeLine(columns)
+}
+
+func (c *csvWriter) writeLine(cells []string) error {
+	c.line.Reset()
+	c.encoder.Write(cells)
+	c.encoder.Flush()
+	if err := c.encoder.Error(); err != nil {
+		return err
+	}
+	c.bytes += int64(c.line.Len())
+	_, err := c.w.Write(c.line.Bytes())
+	return err
+}
+
+func (c *csvWriter) write(fields map[string]interface{}) error {
+	for i, column := range c.columns {
+		switch v := fields[column].(type) {
+		case nil:
+			c.cells[i] = ""
+		case string:
+			c.cells[i] = v
+		case json.Number:
+			c.cells[i] = v.String()
+		case bool:
+			c.cells[i] = strconv.FormatBool(v)
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			c.cells[i] = string(data)
+		}
+	}
+	return c.writeLine(c.cells)
+}
+
+func (c *csvWriter) written() int64 {
+	return c.bytes
+}
+
+func (c *csvWriter) flush() error {
+	return c.w.Flush()
+}
+
+func (c *csvWriter) close() error {
+	return c.w.Flush()
+}
@@ -0,0 +1,549 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// parquet.go - write the rows into parquet files
+
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+const parquetMagic = "PAR1"
+
+// physical types of parquet
+const (
+	parquetBoolean   int32 = 0
+	parquetInt32     int32 = 1
+	parquetInt64     int32 = 2
+	parquetFloat     int32 = 4
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+)
+
+// converted types of parquet, noConvertedType if none
+const (
+	noConvertedType         int32 = -1
+	convertedUTF8           int32 = 0
+	convertedList           int32 = 3
+	convertedDate           int32 = 6
+	convertedTimestampMilli int32 = 9
+	convertedUint8          int32 = 11
+	convertedUint16         int32 = 12
+	convertedUint32         int32 = 13
+	convertedUint64         int32 = 14
+	convertedInt8           int32 = 15
+	convertedInt16          int32 = 16
+	convertedJSON           int32 = 19
+)
+
+const (
+	repetitionRequired int32 = 0
+	repetitionOptional int32 = 1
+	repetitionRepeated int32 = 2
+
+	encodingPlain int32 = 0
+	encodingRLE   int32 = 3
+)
+
+// parquetType is the parquet type of the values of a field type
+type parquetType struct {
+	fieldType api.FieldType
+	physical  int32
+	converted int32
+}
+
+func newParquetType(fieldType api.FieldType) (parquetType, error) {
+	t := parquetType{fieldType: fieldType, converted: noConvertedType}
+	switch fieldType {
+	case api.FieldTypeBool:
+		t.physical = parquetBoolean
+	case api.FieldTypeInt8:
+		t.physical, t.converted = parquetInt32, convertedInt8
+	case api.FieldTypeInt16:
+		t.physical, t.converted = parquetInt32, convertedInt16
+	case api.FieldTypeInt32:
+		t.physical = parquetInt32
+	case api.FieldTypeUint8:
+		t.physical, t.converted = parquetInt32, convertedUint8
+	case api.FieldTypeUint16:
+		t.physical, t.converted = parquetInt32, convertedUint16
+	case api.FieldTypeUint32:
+		t.physical, t.converted = parquetInt32, convertedUint32
+	case api.FieldTypeInt64:
+		t.physical = parquetInt64
+	case api.FieldTypeUint64:
+		t.physical, t.converted = parquetInt64, convertedUint64
+	case api.FieldTypeFloat:
+		t.physical = parquetFloat
+	case api.FieldTypeDouble:
+		t.physical = parquetDouble
+	case api.FieldTypeDate:
+		t.physical, t.converted = parquetInt32, convertedDate
+	case api.FieldTypeDatetime, api.FieldTypeTimestamp:
+		t.physical, t.converted = parquetInt64, convertedTimestampMilli
+	case api.FieldTypeString, api.FieldTypeText, api.FieldTypeTextGBK, api.FieldTypeTextGB18030,
+		api.FieldTypeUUID:
+		t.physical, t.converted = parquetByteArray, convertedUTF8
+	case api.FieldTypeBinary, api.FieldTypeBinaryVector:
+		t.physical = parquetByteArray
+	case api.FieldTypeSparseVector:
+		t.physical, t.converted = parquetByteArray, convertedJSON
+	default:
+		return t, fmt.Errorf("field type %s could not be exported to parquet", fieldType)
+	}
+	return t, nil
+}
+
+// parquetColumn buffers the values of a column within a row group. The scalar fields are optional
+// columns, the float vectors and the arrays optional lists of required elements.
+type parquetColumn struct {
+	name    string
+	element parquetType
+	list    bool
+	defs    []byte
+	reps    []byte
+	values  bytes.Buffer
+	bools   []bool
+}
+
+func (c *parquetColumn) path() []string {
+	if c.list {
+		return []string{c.name, "list", "element"}
+	}
+	return []string{c.name}
+}
+
+func (c *parquetColumn) add(value interface{}) error {
+	if !c.list {
+		if value == nil {
+			c.defs = append(c.defs, 0)
+			return nil
+		}
+		c.defs = append(c.defs, 1)
+		return c.addValue(value)
+	}
+	if value == nil {
+		c.defs, c.reps = append(c.defs, 0), append(c.reps, 0)
+		return nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("%v is not a list", value)
+	}
+	if len(items) == 0 {
+		c.defs, c.reps = append(c.defs, 1), append(c.reps, 0)
+		return nil
+	}
+	for i, item := range items {
+		if item == nil {
+			return fmt.Errorf("element %d is null", i)
+		}
+		rep := byte(1)
+		if i == 0 {
+			rep = 0
+		}
+		c.defs, c.reps = append(c.defs, 2), append(c.reps, rep)
+		if err := c.addValue(item); err != nil {
+			return fmt.Errorf("element %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (c *parquetColumn) addValue(value interface{}) error {
+	var buf [8]byte
+	switch c.element.physical {
+	case parquetBoolean:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("%v is not a boolean", value)
+		}
+		c.bools = append(c.bools, v)
+	case parquetInt32:
+		v, err := int32Value(c.element, value)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(buf[:], uint32(v))
+		c.values.Write(buf[:4])
+	case parquetInt64:
+		v, err := int64Value(c.element, value)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		c.values.Write(buf[:8])
+	case parquetFloat:
+		v, err := strconv.ParseFloat(fmt.Sprint(value), 32)
+		if err != nil {
+			return fmt.Errorf("%v is not a float", value)
+		}
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(float32(v)))
+		c.values.Write(buf[:4])
+	case parquetDouble:
+		v, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return fmt.Errorf("%v is not a double", value)
+		}
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+		c.values.Write(buf[:8])
+	case parquetByteArray:
+		data, err := byteArrayValue(c.element, value)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(data)))
+		c.values.Write(buf[:4])
+		c.values.Write(data)
+	}
+	return nil
+}
+
+func int32Value(t parquetType, value interface{}) (int32, error) {
+	if t.converted == convertedDate {
+		s, _ := value.(string)
+		date, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return 0, fmt.Errorf("%v is not a date", value)
+		}
+		return int32(date.Unix() / 86400), nil
+	}
+	if t.converted == convertedUint32 {
+		v, err := strconv.ParseUint(fmt.Sprint(value), 10, 32)
+		return int32(uint32(v)), err
+	}
+	v, err := strconv.ParseInt(fmt.Sprint(value), 10, 32)
+	return int32(v), err
+}
+
+func int64Value(t parquetType, value interface{}) (int64, error) {
+	switch t.converted {
+	case convertedTimestampMilli:
+		s, _ := value.(string)
+		for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano, "2006-01-02"} {
+			if ts, err := time.Parse(layout, s); err == nil {
+				return ts.UnixNano() / int64(time.Millisecond), nil
+			}
+		}
+		return 0, fmt.Errorf("%v is not a time", value)
+	case convertedUint64:
+		v, err := strconv.ParseUint(fmt.Sprint(value), 10, 64)
+		return int64(v), err
+	}
+	return strconv.ParseInt(fmt.Sprint(value), 10, 64)
+}
+
+func byteArrayValue(t parquetType, value interface{}) ([]byte, error) {
+	switch t.fieldType {
+	case api.FieldTypeSparseVector:
+		return json.Marshal(value)
+	case api.FieldTypeBinary, api.FieldTypeBinaryVector:
+		// the bytes are returned in base64
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not base64", value)
+		}
+		return base64.StdEncoding.DecodeString(s)
+	}
+	switch v := value.(type) {
+	case string:
+		return []byte(v), nil
+	case json.Number:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%v is not a string", value)
+}
+
+// parquetChunk is the metadata of a column chunk written
+type parquetChunk struct {
+	offset       int64
+	numValues    int64
+	uncompressed int64
+	compressed   int64
+}
+
+type parquetRowGroup struct {
+	numRows int64
+	chunks  []parquetChunk
+}
+
+// parquetWriter writes the rows into a parquet file, RowGroupSize rows at a time in a row group
+// holding one data page per column
+type parquetWriter struct {
+	w            io.Writer
+	offset       int64
+	columns      []*parquetColumn
+	compression  Compression
+	compressor   compressor
+	rowGroupSize int
+	rows         int
+	rowGroups    []parquetRowGroup
+	totalRows    int64
+}
+
+func newParquetWriter(w io.Writer, fields []*api.FieldSchema, compression Compression,
+	rowGroupSize int) (*parquetWriter, error) {
+	compressor, err := getCompressor(compression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parquetWriter{w: w, compression: compression, compressor: compressor, rowGroupSize: rowGroupSize}
+	for _, field := range fields {
+		column := &parquetColumn{name: field.FieldName}
+		elementType := field.FieldType
+		switch field.FieldType {
+		case api.FieldTypeFloatVector:
+			column.list, elementType = true, api.FieldTypeFloat
+		case api.FieldTypeArray:
+			column.list, elementType = true, api.FieldType(field.ElementType)
+		}
+		if column.element, err = newParquetType(elementType); err != nil {
+			return nil, fmt.Errorf("field '%s': %v", field.FieldName, err)
+		}
+		p.columns = append(p.columns, column)
+	}
+	return p, p.writeBytes([]byte(parquetMagic))
+}
+
+func (p *parquetWriter) writeBytes(data []byte) error {
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	return err
+}
+
+func (p *parquetWriter) write(fields map[string]interface{}) error {
+	for _, column := range p.columns {
+		if err := column.add(fields[column.name]); err != nil {
+			return fmt.Errorf("field '%s': %v", column.name, err)
+		}
+	}
+	p.rows++
+	if p.rows >= p.rowGroupSize {
+		return p.flushRowGroup()
+	}
+	return nil
+}
+
+func (p *parquetWriter) flushRowGroup() error {
+	if p.rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{numRows: int64(p.rows)}
+	for _, column := range p.columns {
+		chunk, err := p.writeColumn(column)
+		if err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		column.defs, column.reps, column.bools = column.defs[:0], column.reps[:0], column.bools[:0]
+		column.values.Reset()
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.totalRows += int64(p.rows)
+	p.rows = 0
+	return nil
+}
+
+// writeColumn writes the column chunk as a single data page
+func (p *parquetWriter) writeColumn(column *parquetColumn) (parquetChunk, error) {
+	var page bytes.Buffer
+	if column.list {
+		writeLevels(&page, column.reps)
+	}
+	writeLevels(&page, column.defs)
+	if column.element.physical == parquetBoolean {
+		packed := make([]byte, (len(column.bools)+7)/8)
+		for i, v := range column.bools {
+			if v {
+				packed[i/8] |= 1 << uint(i%8)
+			}
+		}
+		page.Write(packed)
+	} else {
+		page.Write(column.values.Bytes())
+	}
+	body := page.Bytes()
+	if p.compressor != nil {
+		var compressed bytes.Buffer
+		cw, err := p.compressor(&compressed)
+		if err != nil {
+			return parquetChunk{}, err
+		}
+		if _, err := cw.Write(body); err != nil {
+			return parquetChunk{}, err
+		}
+		if err := cw.Close(); err != nil {
+			return parquetChunk{}, err
+		}
+		body = compressed.Bytes()
+	}
+	numValues := len(column.defs)
+	header := encodeThrift(func(t *thriftWriter) {
+		t.i32(1, 0) // DATA_PAGE
+		t.i32(2, int32(page.Len()))
+		t.i32(3, int32(len(body)))
+		t.structField(5, func() {
+			t.i32(1, int32(numValues))
+			t.i32(2, encodingPlain)
+			t.i32(3, encodingRLE)
+			t.i32(4, encodingRLE)
+		})
+	})
+	chunk := parquetChunk{
+		offset:       p.offset,
+		numValues:    int64(numValues),
+		uncompressed: int64(len(header) + page.Len()),
+		compressed:   int64(len(header) + len(body)),
+	}
+	if err := p.writeBytes(header); err != nil {
+		return chunk, err
+	}
+	return chunk, p.writeBytes(body)
+}
+
+// writeLevels writes the levels with the RLE encoding prefixed by their length, the levels being
+// at most 2 their values take a byte
+func writeLevels(w *bytes.Buffer, levels []byte) {
+	var runs bytes.Buffer
+	var varint [binary.MaxVarintLen64]byte
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		n := binary.PutUvarint(varint[:], uint64(j-i)<<1)
+		runs.Write(varint[:n])
+		runs.WriteByte(levels[i])
+		i = j
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(runs.Len()))
+	w.Write(length[:])
+	w.Write(runs.Bytes())
+}
+
+// close flushes the last row group and writes the footer
+func (p *parquetWriter) close() error {
+	if err := p.flushRowGroup(); err != nil {
+		return err
+	}
+	footer := encodeThrift(func(t *thriftWriter) {
+		t.i32(1, 1)
+		t.structList(2, 1+p.schemaSize(), func(i int) { p.schemaElement(t, i) })
+		t.i64(3, p.totalRows)
+		t.structList(4, len(p.rowGroups), func(i int) {
+			group := &p.rowGroups[i]
+			var totalBytes int64
+			for _, chunk := range group.chunks {
+				totalBytes += chunk.uncompressed
+			}
+			t.structList(1, len(group.chunks), func(j int) {
+				chunk, column := &group.chunks[j], p.columns[j]
+				t.i64(2, chunk.offset)
+				t.structField(3, func() {
+					t.i32(1, column.element.physical)
+					t.i32List(2, []int32{encodingPlain, encodingRLE})
+					t.strList(3, column.path())
+					t.i32(4, p.compression.parquetCodec())
+					t.i64(5, chunk.numValues)
+					t.i64(6, chunk.uncompressed)
+					t.i64(7, chunk.compressed)
+					t.i64(9, chunk.offset)
+				})
+			})
+			t.i64(2, totalBytes)
+			t.i64(3, group.numRows)
+		})
+		t.str(6, "mochow-sdk-go")
+	})
+	if err := p.writeBytes(footer); err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	if err := p.writeBytes(length[:]); err != nil {
+		return err
+	}
+	return p.writeBytes([]byte(parquetMagic))
+}
+
+// schemaSize returns the number of the schema elements below the root
+func (p *parquetWriter) schemaSize() int {
+	n := 0
+	for _, column := range p.columns {
+		if column.list {
+			n += 3
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// schemaElement writes the i-th element of the flattened schema, the root first
+func (p *parquetWriter) schemaElement(t *thriftWriter, i int) {
+	if i == 0 {
+		t.str(4, "schema")
+		t.i32(5, int32(len(p.columns)))
+		return
+	}
+	n := 1
+	for _, column := range p.columns {
+		size := 1
+		if column.list {
+			size = 3
+		}
+		if i >= n+size {
+			n += size
+			continue
+		}
+		element := column.element
+		switch {
+		case !column.list:
+			writeLeaf(t, column.name, element, repetitionOptional)
+		case i == n:
+			t.i32(3, repetitionOptional)
+			t.str(4, column.name)
+			t.i32(5, 1)
+			t.i32(6, convertedList)
+		case i == n+1:
+			t.i32(3, repetitionRepeated)
+			t.str(4, "list")
+			t.i32(5, 1)
+		default:
+			writeLeaf(t, "element", element, repetitionRequired)
+		}
+		return
+	}
+}
+
+func writeLeaf(t *thriftWriter, name string, element parquetType, repetition int32) {
+	t.i32(1, element.physical)
+	t.i32(3, repetition)
+	t.str(4, name)
+	if element.converted != noConvertedType {
+		t.i32(6, element.converted)
+	}
+}
@@ -0,0 +1,341 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// parquet_test.go - read back the parquet files written by the exporter
+
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// thriftReader decodes the thrift compact protocol, the structs are decoded as maps keyed by the
+// field ids and the lists as slices
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		panic("invalid varint")
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(fieldType byte) interface{} {
+	switch fieldType {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return r.byte()
+	case thriftI32, thriftI64, 4:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		v := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+		return v
+	case thriftList:
+		header := r.byte()
+		size, elementType := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(r.varint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			if elementType == 1 || elementType == 2 {
+				list[i] = r.byte() == 1
+			} else {
+				list[i] = r.value(elementType)
+			}
+		}
+		return list
+	case thriftStruct:
+		return r.structValue()
+	}
+	panic(fmt.Sprintf("unsupported thrift type %d", fieldType))
+}
+
+func (r *thriftReader) structValue() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(header & 0x0f)
+		last = id
+	}
+}
+
+func field(s interface{}, ids ...int16) interface{} {
+	for _, id := range ids {
+		s = s.(map[int16]interface{})[id]
+	}
+	return s
+}
+
+// readLevels decodes the levels written by writeLevels, which only writes RLE runs
+func readLevels(t *testing.T, page []byte, n int) ([]byte, []byte) {
+	length := int(binary.LittleEndian.Uint32(page))
+	r := &thriftReader{data: page[4 : 4+length]}
+	levels := make([]byte, 0, n)
+	for r.pos < len(r.data) {
+		header := r.varint()
+		if header&1 != 0 {
+			t.Fatalf("unexpected bit packed run")
+		}
+		value := r.byte()
+		for i := uint64(0); i < header>>1; i++ {
+			levels = append(levels, value)
+		}
+	}
+	if len(levels) != n {
+		t.Fatalf("expected %d levels, got %d", n, len(levels))
+	}
+	return levels, page[4+length:]
+}
+
+// readColumn decodes the values of the column chunk, the null values being nil and the lists
+// []interface{}
+func readColumn(t *testing.T, file []byte, chunk interface{}, list bool) []interface{} {
+	meta := field(chunk, 3)
+	offset := field(meta, 9).(int64)
+	if offset != field(chunk, 2).(int64) {
+		t.Fatalf("file offset %d differs from data page offset %d", field(chunk, 2), offset)
+	}
+	r := &thriftReader{data: file, pos: int(offset)}
+	header := r.structValue()
+	if field(header, 1).(int64) != 0 {
+		t.Fatalf("page type %d is not a data page", field(header, 1))
+	}
+	size := int(field(header, 3).(int64))
+	page := file[r.pos : r.pos+size]
+	if int64(r.pos-int(offset)+size) != field(meta, 7).(int64) {
+		t.Fatalf("compressed size %d does not match the page", field(meta, 7))
+	}
+	switch field(meta, 4).(int64) {
+	case 2:
+		gz, err := gzip.NewReader(bytes.NewReader(page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page, err = ioutil.ReadAll(gz); err != nil {
+			t.Fatal(err)
+		}
+	case 6:
+		var err error
+		if page, err = zstdDecode(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if int64(len(page)) != field(header, 2).(int64) {
+		t.Fatalf("uncompressed size %d does not match the page of %d bytes", field(header, 2), len(page))
+	}
+	n := int(field(header, 5, 1).(int64))
+	var reps, defs []byte
+	if list {
+		reps, page = readLevels(t, page, n)
+	}
+	defs, page = readLevels(t, page, n)
+	maxDef := byte(1)
+	if list {
+		maxDef = 2
+	}
+	physical := int32(field(meta, 1).(int64))
+	values := make([]interface{}, 0)
+	bit := 0
+	readValue := func() interface{} {
+		switch physical {
+		case parquetBoolean:
+			v := page[bit/8]&(1<<uint(bit%8)) != 0
+			bit++
+			return v
+		case parquetInt32:
+			v := int32(binary.LittleEndian.Uint32(page))
+			page = page[4:]
+			return v
+		case parquetInt64:
+			v := int64(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+			return v
+		case parquetFloat:
+			v := math.Float32frombits(binary.LittleEndian.Uint32(page))
+			page = page[4:]
+			return v
+		case parquetByteArray:
+			n := binary.LittleEndian.Uint32(page)
+			v := string(page[4 : 4+n])
+			page = page[4+n:]
+			return v
+		}
+		t.Fatalf("unexpected physical type %d", physical)
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if list && reps[i] == 1 {
+			items := values[len(values)-1].([]interface{})
+			values[len(values)-1] = append(items, readValue())
+			continue
+		}
+		switch {
+		case defs[i] == 0:
+			values = append(values, nil)
+		case !list:
+			values = append(values, readValue())
+		case defs[i] == 1:
+			values = append(values, []interface{}{})
+		case defs[i] == maxDef:
+			values = append(values, []interface{}{readValue()})
+		}
+	}
+	return values
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	fields := []*api.FieldSchema{
+		{FieldName: "id", FieldType: api.FieldTypeInt64},
+		{FieldName: "name", FieldType: api.FieldTypeString},
+		{FieldName: "ok", FieldType: api.FieldTypeBool},
+		{FieldName: "vector", FieldType: api.FieldTypeFloatVector, Dimension: 2},
+		{FieldName: "tags", FieldType: api.FieldTypeArray, ElementType: api.ElementTypeString},
+	}
+	rows := []map[string]interface{}{
+		{"id": json.Number("1"), "name": "a", "ok": true,
+			"vector": []interface{}{json.Number("0.5"), json.Number("-1")}, "tags": []interface{}{"x", "y"}},
+		{"id": json.Number("2"), "ok": false, "tags": []interface{}{}},
+		{"id": json.Number("3"), "name": "c", "vector": []interface{}{json.Number("2"), json.Number("3")}},
+		{"id": json.Number("4"), "name": "", "ok": true, "vector": []interface{}{}, "tags": []interface{}{"z"}},
+		{"id": json.Number("5")},
+	}
+	expected := [][]interface{}{
+		{int64(1), int64(2), int64(3), int64(4), int64(5)},
+		{"a", nil, "c", "", nil},
+		{true, false, nil, true, nil},
+		{[]interface{}{float32(0.5), float32(-1)}, nil, []interface{}{float32(2), float32(3)}, []interface{}{}, nil},
+		{[]interface{}{"x", "y"}, []interface{}{}, nil, []interface{}{"z"}, nil},
+	}
+
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		name := "uncompressed"
+		if compression != CompressionNone {
+			name = string(compression)
+		}
+		var buf bytes.Buffer
+		p, err := newParquetWriter(&buf, fields, compression, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if err := p.write(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := p.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		file := buf.Bytes()
+		if string(file[:4]) != parquetMagic || string(file[len(file)-4:]) != parquetMagic {
+			t.Fatalf("%s: magic is missing", name)
+		}
+		footerLength := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+		footerStart := len(file) - 8 - footerLength
+		r := &thriftReader{data: file[:len(file)-8], pos: footerStart}
+		meta := r.structValue()
+		if r.pos != len(file)-8 {
+			t.Fatalf("%s: footer of %d bytes decoded as %d bytes", name, footerLength, r.pos-footerStart)
+		}
+		if field(meta, 3).(int64) != int64(len(rows)) {
+			t.Errorf("%s: expected %d rows, got %d", name, len(rows), field(meta, 3))
+		}
+		schema := field(meta, 2).([]interface{})
+		names := make([]string, len(schema))
+		for i, element := range schema {
+			names[i] = field(element, 4).(string)
+		}
+		expectedNames := []string{"schema", "id", "name", "ok", "vector", "list", "element", "tags", "list", "element"}
+		if !reflect.DeepEqual(names, expectedNames) {
+			t.Errorf("%s: schema is %v", name, names)
+		}
+
+		groups := field(meta, 4).([]interface{})
+		if len(groups) != 3 {
+			t.Fatalf("%s: expected 3 row groups, got %d", name, len(groups))
+		}
+		columns := make([][]interface{}, len(fields))
+		for _, group := range groups {
+			chunks := field(group, 1).([]interface{})
+			for i, chunk := range chunks {
+				list := fields[i].FieldType == api.FieldTypeFloatVector || fields[i].FieldType == api.FieldTypeArray
+				values := readColumn(t, file, chunk, list)
+				columns[i] = append(columns[i], values...)
+			}
+		}
+		for i := range fields {
+			if !reflect.DeepEqual(columns[i], expected[i]) {
+				t.Errorf("%s: column %s is %v, expected %v", name, fields[i].FieldName, columns[i], expected[i])
+			}
+		}
+	}
+}
+
+func TestParquetEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	fields := []*api.FieldSchema{{FieldName: "id", FieldType: api.FieldTypeInt64}}
+	p, err := newParquetWriter(&buf, fields, CompressionNone, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.close(); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	r := &thriftReader{data: file, pos: len(file) - 8 - int(binary.LittleEndian.Uint32(file[len(file)-8:]))}
+	meta := r.structValue()
+	if field(meta, 3).(int64) != 0 || len(field(meta, 4).([]interface{})) != 0 {
+		t.Errorf("expected no row and no row group, got %v", meta)
+	}
+}
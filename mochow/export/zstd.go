@@ -0,0 +1,358 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// zstd.go - a zstd encoder, so that the SDK does not depend on a third party one
+
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The frames follow RFC 8878 without the content size nor the checksum. The data is cut into
+// independent blocks whose matches are found through a hash table, the literals are stored
+// raw and the sequences are encoded with the predefined FSE distributions. It compresses less
+// than the reference encoder but the files are read by any zstd decoder.
+const (
+	zstdMagic      = 0xFD2FB528
+	zstdWindow     = 7 << 3 // a window of 128KiB, the size of the blocks
+	zstdBlockSize  = 1 << 17
+	zstdMinMatch   = 4
+	zstdHashLog    = 15
+	zstdBlockRaw   = 0
+	zstdBlockCompr = 2
+)
+
+// the baselines and extra bits of the literal length, match length and offset codes
+var (
+	llBaselines = [36]uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536}
+	llExtraBits = [36]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16}
+	mlBaselines = [53]uint32{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539}
+	mlExtraBits = [53]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16}
+
+	llTable = newFSETable([]int16{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1}, 6)
+	mlTable = newFSETable([]int16{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1}, 6)
+	ofTable = newFSETable([]int16{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1}, 5)
+)
+
+// fseState is a state of the FSE decoder, which outputs symbol and moves to the state baseline
+// plus the next bits
+type fseState struct {
+	symbol   uint8
+	bits     uint8
+	baseline uint16
+}
+
+// fseTable is the FSE table of a distribution, next[s][n] being the state of the symbol s from
+// which the decoder moves to the state n
+type fseTable struct {
+	log    uint
+	states []fseState
+	next   [][]uint16
+}
+
+func newFSETable(distribution []int16, log uint) *fseTable {
+	size := 1 << log
+	t := &fseTable{log: log, states: make([]fseState, size), next: make([][]uint16, len(distribution))}
+	counts := make([]int, len(distribution))
+	high := size - 1
+	for s, n := range distribution {
+		counts[s] = int(n)
+		if n == -1 {
+			t.states[high].symbol = uint8(s)
+			high--
+			counts[s] = 1
+		}
+	}
+	position, step := 0, (size>>1)+(size>>3)+3
+	for s, n := range distribution {
+		for i := 0; i < int(n); i++ {
+			t.states[position].symbol = uint8(s)
+			for position = (position + step) & (size - 1); position > high; {
+				position = (position + step) & (size - 1)
+			}
+		}
+	}
+	for s := range t.next {
+		t.next[s] = make([]uint16, size)
+	}
+	for i := range t.states {
+		state := &t.states[i]
+		n := counts[state.symbol]
+		counts[state.symbol]++
+		state.bits = uint8(log - uint(bitLength(uint32(n))-1))
+		state.baseline = uint16(n<<state.bits - size)
+		for j := 0; j < 1<<state.bits; j++ {
+			t.next[state.symbol][int(state.baseline)+j] = uint16(i)
+		}
+	}
+	return t
+}
+
+func bitLength(v uint32) int {
+	n := 0
+	for ; v != 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+// fseEncoder encodes the symbols backwards, from the last one decoded to the first one
+type fseEncoder struct {
+	table *fseTable
+	state uint16
+}
+
+func (e *fseEncoder) init(table *fseTable, symbol uint8) {
+	e.table = table
+	e.state = table.next[symbol][0]
+}
+
+func (e *fseEncoder) encode(b *bitWriter, symbol uint8) {
+	state := e.table.next[symbol][e.state]
+	b.add(uint32(e.state-e.table.states[state].baseline), uint(e.table.states[state].bits))
+	e.state = state
+}
+
+func (e *fseEncoder) flush(b *bitWriter) {
+	b.add(uint32(e.state), e.table.log)
+}
+
+// bitWriter writes the bits from the lowest ones, the decoder reading them from the end
+type bitWriter struct {
+	out   []byte
+	bits  uint64
+	count uint
+}
+
+func (b *bitWriter) add(value uint32, count uint) {
+	b.bits |= uint64(value) << b.count
+	for b.count += count; b.count >= 8; b.count -= 8 {
+		b.out = append(b.out, byte(b.bits))
+		b.bits >>= 8
+	}
+}
+
+// close writes the end mark followed by the padding of the last byte
+func (b *bitWriter) close() []byte {
+	b.add(1, 1)
+	if b.count > 0 {
+		b.out = append(b.out, byte(b.bits))
+	}
+	return b.out
+}
+
+// zstdSequence copies literals bytes then match bytes from offset bytes back
+type zstdSequence struct {
+	literals uint32
+	match    uint32
+	offset   uint32
+}
+
+func sequenceCode(value uint32, baselines []uint32, direct uint32) uint8 {
+	if value < direct {
+		return uint8(value - baselines[0])
+	}
+	code := len(baselines) - 1
+	for baselines[code] > value {
+		code--
+	}
+	return uint8(code)
+}
+
+// zstdWriter writes a zstd frame, Flush writing the data buffered so far as a block
+type zstdWriter struct {
+	w         io.Writer
+	buf       []byte
+	block     []byte
+	literals  []byte
+	sequences []zstdSequence
+	hashes    []int32
+	started   bool
+	closed    bool
+}
+
+func newZstdWriter(w io.Writer) *zstdWriter {
+	return &zstdWriter{w: w, buf: make([]byte, 0, zstdBlockSize), hashes: make([]int32, 1<<zstdHashLog)}
+}
+
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, errors.New("zstd: write after close")
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if len(z.buf) == zstdBlockSize {
+			if err := z.writeBlock(false); err != nil {
+				return n - len(p), err
+			}
+		}
+		k := copy(z.buf[len(z.buf):zstdBlockSize], p)
+		z.buf = z.buf[:len(z.buf)+k]
+		p = p[k:]
+	}
+	return n, nil
+}
+
+func (z *zstdWriter) Flush() error {
+	if z.closed || (z.started && len(z.buf) == 0) {
+		return nil
+	}
+	return z.writeBlock(false)
+}
+
+// Close writes the last block without closing the underlying writer
+func (z *zstdWriter) Close() error {
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	return z.writeBlock(true)
+}
+
+func (z *zstdWriter) writeBlock(last bool) error {
+	out := z.block[:0]
+	if !z.started {
+		out = append(out, 0, 0, 0, 0, 0, zstdWindow)
+		binary.LittleEndian.PutUint32(out, zstdMagic)
+		z.started = true
+	}
+	if len(z.buf) == 0 && !last {
+		z.block = out
+		_, err := z.w.Write(out)
+		return err
+	}
+	start := len(out)
+	out = append(out, 0, 0, 0)
+	out = z.compress(out, z.buf)
+	header := uint32(len(out)-start-3)<<3 | zstdBlockCompr<<1
+	if len(out)-start-3 >= len(z.buf) {
+		out = append(out[:start+3], z.buf...)
+		header = uint32(len(z.buf))<<3 | zstdBlockRaw<<1
+	}
+	if last {
+		header |= 1
+	}
+	out[start], out[start+1], out[start+2] = byte(header), byte(header>>8), byte(header>>16)
+	z.block = out
+	z.buf = z.buf[:0]
+	_, err := z.w.Write(out)
+	return err
+}
+
+// compress appends the compressed block of src to out, it is not smaller than src if there is
+// no match
+func (z *zstdWriter) compress(out []byte, src []byte) []byte {
+	for i := range z.hashes {
+		z.hashes[i] = 0
+	}
+	z.literals, z.sequences = z.literals[:0], z.sequences[:0]
+	anchor := 0
+	for i := 0; i+zstdMinMatch <= len(src); {
+		current := binary.LittleEndian.Uint32(src[i:])
+		h := current * 2654435761 >> (32 - zstdHashLog)
+		candidate := int(z.hashes[h]) - 1
+		z.hashes[h] = int32(i + 1)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != current {
+			// skip faster through the data without match
+			i += 1 + (i-anchor)>>6
+			continue
+		}
+		length := zstdMinMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		z.literals = append(z.literals, src[anchor:i]...)
+		z.sequences = append(z.sequences, zstdSequence{
+			literals: uint32(i - anchor),
+			match:    uint32(length),
+			offset:   uint32(i - candidate),
+		})
+		i += length
+		anchor = i
+	}
+	if len(z.sequences) == 0 {
+		return append(out, src...)
+	}
+	z.literals = append(z.literals, src[anchor:]...)
+
+	switch n := len(z.literals); {
+	case n < 32:
+		out = append(out, byte(n<<3))
+	case n < 4096:
+		out = append(out, byte(n<<4|1<<2), byte(n>>4))
+	default:
+		out = append(out, byte(n<<4|3<<2), byte(n>>4), byte(n>>12))
+	}
+	out = append(out, z.literals...)
+	switch n := len(z.sequences); {
+	case n < 128:
+		out = append(out, byte(n))
+	case n < 0x7F00:
+		out = append(out, byte(n>>8+128), byte(n))
+	default:
+		out = append(out, 0xFF, byte(n-0x7F00), byte((n-0x7F00)>>8))
+	}
+	// the predefined distributions for the three codes
+	out = append(out, 0)
+	return z.encodeSequences(out)
+}
+
+// encodeSequences appends the bitstream of the sequences, written in the reverse order of the
+// decoding
+func (z *zstdWriter) encodeSequences(out []byte) []byte {
+	b := &bitWriter{out: out}
+	var ll, ml, of fseEncoder
+	for n := len(z.sequences) - 1; n >= 0; n-- {
+		seq := z.sequences[n]
+		llCode := sequenceCode(seq.literals, llBaselines[:], 16)
+		mlCode := sequenceCode(seq.match, mlBaselines[:], 35)
+		offset := seq.offset + 3
+		ofCode := uint8(bitLength(offset) - 1)
+		if n == len(z.sequences)-1 {
+			ml.init(mlTable, mlCode)
+			of.init(ofTable, ofCode)
+			ll.init(llTable, llCode)
+		} else {
+			of.encode(b, ofCode)
+			ml.encode(b, mlCode)
+			ll.encode(b, llCode)
+		}
+		b.add(seq.literals-llBaselines[llCode], uint(llExtraBits[llCode]))
+		b.add(seq.match-mlBaselines[mlCode], uint(mlExtraBits[mlCode]))
+		b.add(offset-1<<ofCode, uint(ofCode))
+	}
+	ml.flush(b)
+	of.flush(b)
+	ll.flush(b)
+	return b.close()
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// zstd_test.go - decode the zstd frames written by the encoder
+
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"testing"
+)
+
+// bitReader reads the bits of a sequence bitstream backwards, from its end mark
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func newBitReader(data []byte) (*bitReader, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, fmt.Errorf("no end mark")
+	}
+	return &bitReader{data: data, pos: len(data)*8 - 9 + bitLength(uint32(data[len(data)-1]))}, nil
+}
+
+func (r *bitReader) read(count uint8) (uint32, error) {
+	if int(count) > r.pos {
+		return 0, fmt.Errorf("bitstream overflow")
+	}
+	r.pos -= int(count)
+	var v uint32
+	for i := 0; i < int(count); i++ {
+		bit := uint32(r.data[(r.pos+i)/8]>>uint((r.pos+i)%8)) & 1
+		v |= bit << uint(i)
+	}
+	return v, nil
+}
+
+// zstdDecode decodes the frames written by zstdWriter: raw and compressed blocks, the latter
+// with raw literals and the predefined distributions
+func zstdDecode(data []byte) ([]byte, error) {
+	var out []byte
+	for len(data) > 0 {
+		if len(data) < 6 || binary.LittleEndian.Uint32(data) != zstdMagic {
+			return nil, fmt.Errorf("invalid frame header")
+		}
+		if data[4] != 0 || data[5] != zstdWindow {
+			return nil, fmt.Errorf("unexpected frame descriptor %x", data[4:6])
+		}
+		data = data[6:]
+		frameStart := len(out)
+		for last := false; !last; {
+			if len(data) < 3 {
+				return nil, fmt.Errorf("truncated block header")
+			}
+			header := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+			last = header&1 == 1
+			size := int(header >> 3)
+			if len(data) < 3+size || size > zstdBlockSize {
+				return nil, fmt.Errorf("invalid block size %d", size)
+			}
+			block := data[3 : 3+size]
+			data = data[3+size:]
+			switch header >> 1 & 3 {
+			case zstdBlockRaw:
+				out = append(out, block...)
+			case zstdBlockCompr:
+				var err error
+				if out, err = decodeBlock(out, frameStart, block); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, fmt.Errorf("unexpected block type %d", header>>1&3)
+			}
+		}
+	}
+	return out, nil
+}
+
+func decodeBlock(out []byte, frameStart int, block []byte) ([]byte, error) {
+	if block[0]&3 != 0 {
+		return nil, fmt.Errorf("literals are not raw")
+	}
+	var literalsSize, headerSize int
+	switch block[0] >> 2 & 3 {
+	case 0, 2:
+		literalsSize, headerSize = int(block[0]>>3), 1
+	case 1:
+		literalsSize, headerSize = int(block[0]>>4)|int(block[1])<<4, 2
+	case 3:
+		literalsSize, headerSize = int(block[0]>>4)|int(block[1])<<4|int(block[2])<<12, 3
+	}
+	literals := block[headerSize : headerSize+literalsSize]
+	block = block[headerSize+literalsSize:]
+	count := int(block[0])
+	switch {
+	case count == 255:
+		count, block = int(block[1])+int(block[2])<<8+0x7F00, block[3:]
+	case count >= 128:
+		count, block = (count-128)<<8+int(block[1]), block[2:]
+	default:
+		block = block[1:]
+	}
+	if count == 0 {
+		return append(out, literals...), nil
+	}
+	if block[0] != 0 {
+		return nil, fmt.Errorf("unexpected symbol compression modes %x", block[0])
+	}
+	r, err := newBitReader(block[1:])
+	if err != nil {
+		return nil, err
+	}
+	read := func(count uint8) uint32 {
+		v, readErr := r.read(count)
+		if err == nil {
+			err = readErr
+		}
+		return v
+	}
+	ll, of, ml := read(6), read(5), read(6)
+	for i := 0; i < count; i++ {
+		llState, ofState, mlState := llTable.states[ll], ofTable.states[of], mlTable.states[ml]
+		offset := 1<<ofState.symbol + read(ofState.symbol)
+		match := mlBaselines[mlState.symbol] + read(mlExtraBits[mlState.symbol])
+		literalLength := llBaselines[llState.symbol] + read(llExtraBits[llState.symbol])
+		if i < count-1 {
+			ll = uint32(llState.baseline) + read(llState.bits)
+			ml = uint32(mlState.baseline) + read(mlState.bits)
+			of = uint32(ofState.baseline) + read(ofState.bits)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if int(literalLength) > len(literals) {
+			return nil, fmt.Errorf("sequence %d has %d literals left", i, len(literals))
+		}
+		out = append(out, literals[:literalLength]...)
+		literals = literals[literalLength:]
+		if offset <= 3 || int(offset-3) > len(out)-frameStart {
+			return nil, fmt.Errorf("invalid offset %d of sequence %d", offset, i)
+		}
+		for j, start := uint32(0), len(out)-int(offset-3); j < match; j++ {
+			out = append(out, out[start+int(j)])
+		}
+	}
+	if r.pos != 0 {
+		return nil, fmt.Errorf("%d bits left in the bitstream", r.pos)
+	}
+	return append(out, literals...), nil
+}
+
+// zstdInputs returns data of various sizes and redundancies, including long runs, long literals
+// and more than a block
+func zstdInputs() [][]byte {
+	random := rand.New(rand.NewSource(1))
+	noise := make([]byte, 300000)
+	random.Read(noise)
+	var rows bytes.Buffer
+	for i := 0; rows.Len() < 400000; i++ {
+		fmt.Fprintf(&rows, `{"id":%d,"name":"row %d","vector":[%f,%f]}`+"\n", i, random.Intn(1000),
+			random.Float32(), random.Float32())
+	}
+	mixed := append(append(append([]byte{}, noise[:70000]...), bytes.Repeat([]byte("a"), 100000)...),
+		rows.Bytes()[:50000]...)
+	return [][]byte{nil, []byte("a"), []byte("abcdabcdabcdabcd"), noise, rows.Bytes(), mixed}
+}
+
+func zstdEncode(t *testing.T, data []byte, flushEvery int) []byte {
+	var buf bytes.Buffer
+	z := newZstdWriter(&buf)
+	for len(data) > 0 {
+		n := flushEvery
+		if n <= 0 || n > len(data) {
+			n = len(data)
+		}
+		if _, err := z.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+		if flushEvery > 0 {
+			if err := z.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestZstdRoundTrip(t *testing.T) {
+	for i, data := range zstdInputs() {
+		for _, flushEvery := range []int{0, 1000, 77777} {
+			encoded := zstdEncode(t, data, flushEvery)
+			decoded, err := zstdDecode(encoded)
+			if err != nil {
+				t.Fatalf("input %d flushed every %d: %v", i, flushEvery, err)
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Fatalf("input %d flushed every %d: decoded %d bytes differ from %d bytes", i,
+					flushEvery, len(decoded), len(data))
+			}
+		}
+	}
+	rows := zstdInputs()[4]
+	if encoded := zstdEncode(t, rows, 0); len(encoded) > len(rows)/2 {
+		t.Errorf("rows of %d bytes compressed into %d bytes", len(rows), len(encoded))
+	}
+}
+
+// TestZstdReference checks the frames against the zstd command if it is installed
+func TestZstdReference(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd is not installed")
+	}
+	for i, data := range zstdInputs() {
+		for _, flushEvery := range []int{0, 5000} {
+			cmd := exec.Command("zstd", "-d", "-c")
+			cmd.Stdin = bytes.NewReader(zstdEncode(t, data, flushEvery))
+			decoded, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("input %d flushed every %d: %v", i, flushEvery, err)
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Fatalf("input %d flushed every %d: zstd decoded %d bytes differ from %d bytes", i,
+					flushEvery, len(decoded), len(data))
+			}
+		}
+	}
+}
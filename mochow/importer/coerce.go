@@ -0,0 +1,326 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// coerce.go - convert the imported values to the types of the fields
+
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+const (
+	dateLayout     = "2006-01-02"
+	datetimeLayout = "2006-01-02 15:04:05"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Coerce converts a value decoded from JSON with UseNumber, or a CSV cell, to the type of the
+// field and checks the array capacity and the vector dimension. The strings are parsed for the
+// other types, the arrays and the vectors may be written as JSON arrays or as lists delimited by
+// commas, semicolons, bars or spaces, the binary vectors also as base64 and the sparse vectors as
+// JSON objects. A nil value is returned as is.
+func Coerce(field *api.FieldSchema, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch field.FieldType {
+	case api.FieldTypeFloatVector:
+		items, err := toList(value)
+		if err != nil {
+			return nil, err
+		}
+		vector := make(api.FloatVector, len(items))
+		for i, item := range items {
+			v, err := toFloat(item, 32)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %v", i, err)
+			}
+			vector[i] = float32(v)
+		}
+		if field.Dimension > 0 && len(vector) != int(field.Dimension) {
+			return nil, fmt.Errorf("vector has dimension %d, %d expected", len(vector), field.Dimension)
+		}
+		return vector, nil
+	case api.FieldTypeBinaryVector:
+		vector, err := toBinaryVector(value)
+		if err != nil {
+			return nil, err
+		}
+		if field.Dimension > 0 && len(vector)*8 != int(field.Dimension) {
+			return nil, fmt.Errorf("binary vector has dimension %d, %d expected", len(vector)*8, field.Dimension)
+		}
+		return vector, nil
+	case api.FieldTypeSparseVector:
+		return toSparseVector(value)
+	case api.FieldTypeArray:
+		items, err := toList(value)
+		if err != nil {
+			return nil, err
+		}
+		if field.MaxCapacity > 0 && len(items) > int(field.MaxCapacity) {
+			return nil, fmt.Errorf("array has %d elements, more than the capacity %d", len(items), field.MaxCapacity)
+		}
+		elementType := api.FieldType(field.ElementType)
+		array := make([]interface{}, len(items))
+		for i, item := range items {
+			if item == nil {
+				return nil, fmt.Errorf("element %d is null", i)
+			}
+			v, err := coerceScalar(elementType, item)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %v", i, err)
+			}
+			array[i] = v
+		}
+		return array, nil
+	}
+	return coerceScalar(field.FieldType, value)
+}
+
+func coerceScalar(fieldType api.FieldType, value interface{}) (interface{}, error) {
+	switch fieldType {
+	case api.FieldTypeBool:
+		return toBool(value)
+	case api.FieldTypeInt8:
+		v, err := toInt(value, 8)
+		return int8(v), err
+	case api.FieldTypeInt16:
+		v, err := toInt(value, 16)
+		return int16(v), err
+	case api.FieldTypeInt32:
+		v, err := toInt(value, 32)
+		return int32(v), err
+	case api.FieldTypeInt64:
+		return toInt(value, 64)
+	case api.FieldTypeUint8:
+		v, err := toUint(value, 8)
+		return uint8(v), err
+	case api.FieldTypeUint16:
+		v, err := toUint(value, 16)
+		return uint16(v), err
+	case api.FieldTypeUint32:
+		v, err := toUint(value, 32)
+		return uint32(v), err
+	case api.FieldTypeUint64:
+		return toUint(value, 64)
+	case api.FieldTypeFloat:
+		v, err := toFloat(value, 32)
+		return float32(v), err
+	case api.FieldTypeDouble:
+		return toFloat(value, 64)
+	case api.FieldTypeDate:
+		return toTime(value, dateLayout)
+	case api.FieldTypeDatetime, api.FieldTypeTimestamp:
+		return toTime(value, datetimeLayout)
+	case api.FieldTypeUUID:
+		s, err := toString(value)
+		if err == nil && !uuidPattern.MatchString(s) {
+			err = fmt.Errorf("'%s' is not a UUID", s)
+		}
+		return s, err
+	case api.FieldTypeString, api.FieldTypeBinary, api.FieldTypeText, api.FieldTypeTextGBK,
+		api.FieldTypeTextGB18030:
+		return toString(value)
+	}
+	return nil, fmt.Errorf("unsupported field type %s", fieldType)
+}
+
+// scalarString returns the text of a string or a number
+func scalarString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v), true
+	case json.Number:
+		return v.String(), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+func toBool(value interface{}) (bool, error) {
+	if v, ok := value.(bool); ok {
+		return v, nil
+	}
+	if s, ok := scalarString(value); ok {
+		if v, err := strconv.ParseBool(s); err == nil {
+			return v, nil
+		}
+	}
+	return false, fmt.Errorf("%v is not a boolean", value)
+}
+
+func toInt(value interface{}, bits int) (int64, error) {
+	s, ok := scalarString(value)
+	if !ok {
+		return 0, fmt.Errorf("%v is not an integer", value)
+	}
+	v, err := strconv.ParseInt(s, 10, bits)
+	if err == nil {
+		return v, nil
+	}
+	// an integral number written with a fraction or an exponent, e.g. 3.0 or 1e3
+	if f, ferr := strconv.ParseFloat(s, 64); ferr == nil && f == math.Trunc(f) {
+		if v, err = strconv.ParseInt(strconv.FormatFloat(f, 'f', -1, 64), 10, bits); err == nil {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("'%s' is not an int%d", s, bits)
+}
+
+func toUint(value interface{}, bits int) (uint64, error) {
+	s, ok := scalarString(value)
+	if !ok {
+		return 0, fmt.Errorf("%v is not an integer", value)
+	}
+	v, err := strconv.ParseUint(s, 10, bits)
+	if err == nil {
+		return v, nil
+	}
+	if f, ferr := strconv.ParseFloat(s, 64); ferr == nil && f == math.Trunc(f) && f >= 0 {
+		if v, err = strconv.ParseUint(strconv.FormatFloat(f, 'f', -1, 64), 10, bits); err == nil {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("'%s' is not a uint%d", s, bits)
+}
+
+func toFloat(value interface{}, bits int) (float64, error) {
+	s, ok := scalarString(value)
+	if !ok {
+		return 0, fmt.Errorf("%v is not a number", value)
+	}
+	v, err := strconv.ParseFloat(s, bits)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a float%d", s, bits)
+	}
+	return v, nil
+}
+
+func toString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("%v is not a string", value)
+}
+
+// toTime accepts the layout of the field, RFC 3339 and dates, and returns the time in the layout
+func toTime(value interface{}, layout string) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%v is not a time", value)
+	}
+	s = strings.TrimSpace(s)
+	for _, l := range []string{layout, datetimeLayout, time.RFC3339Nano, "2006-01-02T15:04:05", dateLayout} {
+		if t, err := time.Parse(l, s); err == nil {
+			return t.Format(layout), nil
+		}
+	}
+	return "", fmt.Errorf("'%s' is not a time of layout '%s'", s, layout)
+}
+
+// toList returns the elements of a JSON array or of a string holding a JSON array or a
+// delimited list
+func toList(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if strings.HasPrefix(s, "[") {
+			var items []interface{}
+			decoder := json.NewDecoder(strings.NewReader(s))
+			decoder.UseNumber()
+			if err := decoder.Decode(&items); err != nil {
+				return nil, fmt.Errorf("invalid JSON array: %v", err)
+			}
+			return items, nil
+		}
+		parts := strings.FieldsFunc(s, isListDelimiter)
+		items := make([]interface{}, len(parts))
+		for i, part := range parts {
+			items[i] = part
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("%v is not a list", value)
+}
+
+func isListDelimiter(r rune) bool {
+	return r == ',' || r == ';' || r == '|' || unicode.IsSpace(r)
+}
+
+// toBinaryVector accepts the bytes as a list or as base64
+func toBinaryVector(value interface{}) (api.BinaryVector, error) {
+	if s, ok := value.(string); ok {
+		s = strings.TrimSpace(s)
+		if !strings.HasPrefix(s, "[") && strings.IndexFunc(s, isListDelimiter) < 0 {
+			if data, err := base64.StdEncoding.DecodeString(s); err == nil {
+				return data, nil
+			}
+		}
+	}
+	items, err := toList(value)
+	if err != nil {
+		return nil, err
+	}
+	vector := make(api.BinaryVector, len(items))
+	for i, item := range items {
+		v, err := toUint(item, 8)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %v", i, err)
+		}
+		vector[i] = byte(v)
+	}
+	return vector, nil
+}
+
+// toSparseVector accepts a JSON object of the values by index
+func toSparseVector(value interface{}) (api.SparseFloatVector, error) {
+	object, ok := value.(map[string]interface{})
+	if s, isString := value.(string); isString {
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		ok = decoder.Decode(&object) == nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("%v is not a JSON object of the values by index", value)
+	}
+	vector := make(api.SparseFloatVector, len(object))
+	for index, item := range object {
+		v, err := toFloat(item, 32)
+		if err != nil {
+			return nil, fmt.Errorf("index %s: %v", index, err)
+		}
+		vector[index] = float32(v)
+	}
+	return vector, nil
+}
@@ -0,0 +1,294 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// importer.go - import the records of a JSONL or CSV file into a table
+
+// Package importer implements the import of JSONL and CSV files into a table, the values being
+// converted to the types of the fields given by the schema of the table.
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+const DefaultBatchSize = 500
+
+// Format is the format of the imported file
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl" // a JSON object per line
+	FormatCSV   Format = "csv"   // a header line naming the columns followed by a line per record
+)
+
+// FormatOf returns the format given by the extension of the path, ".tsv" files being CSV
+// separated by tabs
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson", ".json":
+		return FormatJSONL, nil
+	case ".csv", ".tsv":
+		return FormatCSV, nil
+	}
+	return "", fmt.Errorf("unknown format of '%s'", path)
+}
+
+// Options describes an import. The keys of the JSON objects and the columns of the CSV files
+// are the names of the fields unless renamed by Mapping, a key mapped to "-" is left out. The
+// records holding a key which is not a field are rejected unless IgnoreUnknown.
+//
+// The records are read BatchSize at a time and their rows written by insert, or upsert if
+// Upsert, each batch split by Chunk if not nil. The records which could not be converted to rows
+// are rejected, each of them written as a JSON Reject line into Rejects if not nil, and the
+// import stops with an error after the batch in which more than MaxRejects are rejected if
+// MaxRejects is positive. The records before Offset are skipped, e.g. to resume an import from
+// the NextOffset of a failed one, and at most Limit records are imported if Limit is positive.
+//
+// The offsets count records rather than lines: the blank lines of a JSONL file are records, but
+// the header and the empty lines of a CSV file are not and a quoted CSV cell may span several
+// lines. An import is resumed from a Reject by its Offset, not its Line.
+type Options struct {
+	Database      string
+	Table         string
+	Format        Format
+	Comma         rune // separator of the CSV columns, ',' by default
+	Mapping       map[string]string
+	IgnoreUnknown bool
+	BatchSize     int
+	Upsert        bool
+	Chunk         *api.ChunkOptions
+	Rejects       io.Writer
+	MaxRejects    int64
+	Offset        int64
+	Limit         int64
+}
+
+// Result counts the records read after the offset, the rows written and the records rejected.
+// NextOffset is the offset of the first record not imported.
+type Result struct {
+	Records    int64
+	Rows       int64
+	Rejected   int64
+	NextOffset int64
+}
+
+// Reject is a record which could not be imported, Line is the line of the file where it starts,
+// Offset the offset of the record as counted by Options.Offset and Record its text
+type Reject struct {
+	Line   int64  `json:"line"`
+	Offset int64  `json:"offset"`
+	Reason string `json:"reason"`
+	Record string `json:"record,omitempty"`
+}
+
+type importer struct {
+	cli     client.Client
+	options Options
+	fields  map[string]*api.FieldSchema
+	schema  []api.FieldSchema
+	result  Result
+	rows    []api.Row
+	rejects []Reject
+	pending int64 // records of the batch
+}
+
+// ImportFile imports the file, its format is given by its extension unless set in options
+func ImportFile(cli client.Client, path string, options *Options) (*Result, error) {
+	opts := *options
+	if len(opts.Format) == 0 {
+		format, err := FormatOf(path)
+		if err != nil {
+			return &Result{NextOffset: opts.Offset}, err
+		}
+		opts.Format = format
+	}
+	if opts.Comma == 0 && strings.EqualFold(filepath.Ext(path), ".tsv") {
+		opts.Comma = '\t'
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return &Result{NextOffset: opts.Offset}, err
+	}
+	defer file.Close()
+	return Import(cli, file, &opts)
+}
+
+// Import imports the records read from r into the table. On failure the records imported so
+// far are counted in the returned result along with the error.
+func Import(cli client.Client, r io.Reader, options *Options) (*Result, error) {
+	im := &importer{cli: cli, options: *options}
+	opts := &im.options
+	im.result.NextOffset = opts.Offset
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if err := im.describe(); err != nil {
+		return &im.result, err
+	}
+	var src source
+	switch opts.Format {
+	case FormatJSONL:
+		src = newJSONLSource(r)
+	case FormatCSV:
+		csvSrc, err := newCSVSource(r, opts.Comma)
+		if err != nil {
+			return &im.result, err
+		}
+		src = csvSrc
+	default:
+		return &im.result, fmt.Errorf("unsupported format '%s'", opts.Format)
+	}
+	for i := int64(0); i < opts.Offset; i++ {
+		if _, err := src.next(); err != nil {
+			if err == io.EOF {
+				return &im.result, fmt.Errorf("offset %d is beyond the last record", opts.Offset)
+			}
+			return &im.result, err
+		}
+	}
+
+	for opts.Limit <= 0 || im.result.Records+im.pending < opts.Limit {
+		rec, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &im.result, err
+		}
+		offset := im.result.NextOffset + im.pending
+		im.pending++
+		if !rec.blank {
+			if row, err := im.convert(rec); err != nil {
+				im.rejects = append(im.rejects, Reject{Line: rec.line, Offset: offset, Reason: err.Error(),
+					Record: rec.raw})
+			} else {
+				im.rows = append(im.rows, row)
+			}
+		}
+		if im.pending >= int64(opts.BatchSize) {
+			if err := im.flush(); err != nil {
+				return &im.result, err
+			}
+		}
+	}
+	if err := im.flush(); err != nil {
+		return &im.result, err
+	}
+	return &im.result, nil
+}
+
+func (im *importer) describe() error {
+	desc, err := api.DescTable(im.cli, &api.DescTableArgs{Database: im.options.Database, Table: im.options.Table})
+	if err != nil {
+		return err
+	}
+	if desc.Table == nil || desc.Table.Schema == nil {
+		return fmt.Errorf("schema of table '%s' is not available", im.options.Table)
+	}
+	im.schema = desc.Table.Schema.Fields
+	im.fields = make(map[string]*api.FieldSchema, len(im.schema))
+	for i := range im.schema {
+		im.fields[im.schema[i].FieldName] = &im.schema[i]
+	}
+	return nil
+}
+
+// convert returns the row of the record, or the reason why it is rejected
+func (im *importer) convert(rec *record) (api.Row, error) {
+	if rec.err != nil {
+		return api.Row{}, rec.err
+	}
+	keys := make([]string, 0, len(rec.fields))
+	for key := range rec.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		name := key
+		if mapped, ok := im.options.Mapping[key]; ok {
+			name = mapped
+		}
+		if name == "-" {
+			continue
+		}
+		field, ok := im.fields[name]
+		if !ok {
+			if im.options.IgnoreUnknown {
+				continue
+			}
+			return api.Row{}, fmt.Errorf("unknown field '%s'", name)
+		}
+		value, err := Coerce(field, rec.fields[key])
+		if err != nil {
+			return api.Row{}, fmt.Errorf("field '%s': %v", name, err)
+		}
+		if value != nil {
+			fields[name] = value
+		}
+	}
+	for i := range im.schema {
+		field := &im.schema[i]
+		if _, ok := fields[field.FieldName]; !ok && field.NotNull && !field.AutoIncrement {
+			return api.Row{}, fmt.Errorf("field '%s' should not be null", field.FieldName)
+		}
+	}
+	return api.Row{Fields: fields}, nil
+}
+
+// flush writes the rows of the batch, then its rejects so that they are not written twice when
+// the import is resumed after a failed batch
+func (im *importer) flush() error {
+	if len(im.rows) > 0 {
+		args := &api.InsertRowArgs{Database: im.options.Database, Table: im.options.Table, Rows: im.rows}
+		var err error
+		if im.options.Upsert {
+			_, err = api.ChunkedUpsertRow(im.cli, (*api.UpsertRowArg)(args), im.options.Chunk)
+		} else {
+			_, err = api.ChunkedInsertRow(im.cli, args, im.options.Chunk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if im.options.Rejects != nil {
+		for i := range im.rejects {
+			data, err := json.Marshal(&im.rejects[i])
+			if err != nil {
+				return err
+			}
+			if _, err := im.options.Rejects.Write(append(data, '\n')); err != nil {
+				return err
+			}
+		}
+	}
+	im.result.Records += im.pending
+	im.result.Rows += int64(len(im.rows))
+	im.result.Rejected += int64(len(im.rejects))
+	im.result.NextOffset += im.pending
+	im.rows, im.rejects, im.pending = nil, nil, 0
+	if im.options.MaxRejects > 0 && im.result.Rejected > im.options.MaxRejects {
+		return fmt.Errorf("%d records rejected, more than %d", im.result.Rejected, im.options.MaxRejects)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// source.go - read the records of the JSONL and CSV files
+
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// record is a record of the input, err tells why it could not be parsed. The blank records are
+// counted but not imported.
+type record struct {
+	line   int64
+	fields map[string]interface{}
+	raw    string
+	err    error
+	blank  bool
+}
+
+// source reads the records one at a time, io.EOF at the end
+type source interface {
+	next() (*record, error)
+}
+
+// jsonlSource reads a JSON object per line
+type jsonlSource struct {
+	scanner *bufio.Scanner
+	line    int64
+}
+
+func newJSONLSource(r io.Reader) *jsonlSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return &jsonlSource{scanner: scanner}
+}
+
+func (s *jsonlSource) next() (*record, error) {
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return nil, fmt.Errorf("line %d: %v", s.line+1, err)
+		}
+		return nil, io.EOF
+	}
+	s.line++
+	line := bytes.TrimSpace(s.scanner.Bytes())
+	rec := &record{line: s.line, raw: string(line), fields: make(map[string]interface{})}
+	if len(line) == 0 {
+		rec.blank = true
+		return rec, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&rec.fields); err != nil {
+		rec.err = fmt.Errorf("invalid JSON object: %v", err)
+	}
+	return rec, nil
+}
+
+// csvSource reads the records of a CSV file whose first line holds the names of the columns.
+// The empty cells are left out of the records.
+type csvSource struct {
+	reader *csv.Reader
+	header []string
+}
+
+func newCSVSource(r io.Reader, comma rune) (*csvSource, error) {
+	reader := csv.NewReader(r)
+	if comma != 0 {
+		reader.Comma = comma
+	}
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV has no header")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CSV header: %v", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	if len(header) > 0 {
+		// the byte order mark written by some spreadsheets
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	return &csvSource{reader: reader, header: header}, nil
+}
+
+func (s *csvSource) next() (*record, error) {
+	cells, err := s.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if err != nil && !errors.As(err, &parseErr) {
+		return nil, err
+	}
+	if err != nil {
+		if len(cells) == 0 {
+			return &record{line: int64(parseErr.StartLine), err: err}, nil
+		}
+		line, _ := s.reader.FieldPos(0)
+		return &record{line: int64(line), raw: s.encode(cells), err: err}, nil
+	}
+	line, _ := s.reader.FieldPos(0)
+	rec := &record{line: int64(line), raw: s.encode(cells), fields: make(map[string]interface{})}
+	for i, cell := range cells {
+		if len(cell) > 0 {
+			rec.fields[s.header[i]] = cell
+		}
+	}
+	return rec, nil
+}
+
+func (s *csvSource) encode(cells []string) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = s.reader.Comma
+	w.Write(cells)
+	w.Flush()
+	return strings.TrimRight(buf.String(), "\r\n")
+}
@@ -0,0 +1,289 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// pipeline.go - ingest documents as chunk rows referencing parent rows
+
+// Package ingest implements the ingestion of documents for retrieval augmented generation: the
+// documents are split into chunks, the chunks are embedded and stored in a chunk table while
+// the documents are stored in a parent table.
+package ingest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+const (
+	DefaultChunkIDField    = "id"
+	DefaultParentIDField   = "parentId"
+	DefaultChunkIndexField = "chunkIndex"
+	DefaultTextField       = "text"
+	DefaultVectorField     = "vector"
+	DefaultParentKeyField  = "id"
+)
+
+// Options configures the pipeline. The chunk table holds one row per chunk, its primary key
+// ChunkIDField is a string "<parent id>#<chunk index>". The parent table, optional, holds one
+// row per document keyed by ParentKeyField, it is assumed to be partitioned by the same field.
+// ParentTextField stores the whole text of the document in the parent row if not empty.
+// The chunk text is embedded into VectorField by Embedder, no vector is written without it.
+// The parent rows and the chunk rows are written with as many requests as Chunk requires.
+type Options struct {
+	Database        string
+	ChunkTable      string
+	ParentTable     string
+	Splitter        Splitter
+	Embedder        api.Embedder
+	BatchSize       int // texts per Embed call
+	CacheSize       int // embeddings kept in cache
+	ChunkIDField    string
+	ParentIDField   string
+	ChunkIndexField string
+	TextField       string
+	VectorField     string
+	ParentKeyField  string
+	ParentTextField string
+	Chunk           *api.ChunkOptions
+}
+
+// Document is a text to ingest. Fields are written to the parent row and ChunkFields to every
+// chunk row of the document.
+type Document struct {
+	ID          string
+	Text        string
+	Fields      map[string]interface{}
+	ChunkFields map[string]interface{}
+}
+
+// IngestResult counts the rows written by an ingestion
+type IngestResult struct {
+	Documents int
+	Chunks    int
+}
+
+// RetrievedChunk is a chunk row with its parent row, Parent is nil if the parent is not found
+type RetrievedChunk struct {
+	api.RowResult
+	Parent *api.Row
+}
+
+type Pipeline struct {
+	cli     client.Client
+	options Options
+	table   *api.EmbeddingTable
+}
+
+// NewPipeline returns the pipeline writing by the client, which is usually a *mochow.Client
+func NewPipeline(cli client.Client, options *Options) (*Pipeline, error) {
+	if options.Splitter == nil {
+		return nil, fmt.Errorf("splitter should not be nil")
+	}
+	if len(options.ChunkTable) == 0 {
+		return nil, fmt.Errorf("chunk table should not be empty")
+	}
+	p := &Pipeline{cli: cli, options: *options}
+	o := &p.options
+	setDefault(&o.ChunkIDField, DefaultChunkIDField)
+	setDefault(&o.ParentIDField, DefaultParentIDField)
+	setDefault(&o.ChunkIndexField, DefaultChunkIndexField)
+	setDefault(&o.TextField, DefaultTextField)
+	setDefault(&o.VectorField, DefaultVectorField)
+	setDefault(&o.ParentKeyField, DefaultParentKeyField)
+	if o.Embedder != nil {
+		table, err := api.NewEmbeddingTable(cli, &api.EmbeddingTableArgs{
+			Database: o.Database,
+			Table:    o.ChunkTable,
+			Fields: []api.EmbeddingField{
+				{TextField: o.TextField, VectorField: o.VectorField, Embedder: o.Embedder},
+			},
+			BatchSize: o.BatchSize,
+			CacheSize: o.CacheSize,
+		}, o.Chunk)
+		if err != nil {
+			return nil, err
+		}
+		p.table = table
+	}
+	return p, nil
+}
+
+// Ingest splits and writes the documents. The parent rows and the chunk rows are upserted, the
+// chunks left from a previous ingestion of a document with more chunks are deleted.
+func (p *Pipeline) Ingest(documents []Document) (*IngestResult, error) {
+	o := &p.options
+	result := &IngestResult{}
+	parents := make([]api.Row, 0, len(documents))
+	chunks := make([]api.Row, 0)
+	counts := make([]int, len(documents))
+	for i, document := range documents {
+		if len(document.ID) == 0 {
+			return nil, fmt.Errorf("id of document %d should not be empty", i)
+		}
+		texts, err := o.Splitter.Split(document.Text)
+		if err != nil {
+			return nil, err
+		}
+		counts[i] = len(texts)
+		for index, text := range texts {
+			fields := make(map[string]interface{}, len(document.ChunkFields)+4)
+			for k, v := range document.ChunkFields {
+				fields[k] = v
+			}
+			fields[o.ChunkIDField] = ChunkID(document.ID, index)
+			fields[o.ParentIDField] = document.ID
+			fields[o.ChunkIndexField] = index
+			fields[o.TextField] = text
+			chunks = append(chunks, api.Row{Fields: fields})
+		}
+		if len(o.ParentTable) > 0 {
+			fields := make(map[string]interface{}, len(document.Fields)+2)
+			for k, v := range document.Fields {
+				fields[k] = v
+			}
+			fields[o.ParentKeyField] = document.ID
+			if len(o.ParentTextField) > 0 {
+				fields[o.ParentTextField] = document.Text
+			}
+			parents = append(parents, api.Row{Fields: fields})
+		}
+	}
+
+	if len(parents) > 0 {
+		if _, err := api.ChunkedUpsertRow(p.cli, &api.UpsertRowArg{
+			Database: o.Database,
+			Table:    o.ParentTable,
+			Rows:     parents,
+		}, o.Chunk); err != nil {
+			return nil, err
+		}
+	}
+	if len(chunks) > 0 {
+		var err error
+		if p.table != nil {
+			_, err = p.table.UpsertRow(chunks)
+		} else {
+			_, err = api.ChunkedUpsertRow(p.cli, &api.UpsertRowArg{
+				Database: o.Database,
+				Table:    o.ChunkTable,
+				Rows:     chunks,
+			}, o.Chunk)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, document := range documents {
+		if err := p.deleteStaleChunks(document.ID, counts[i]); err != nil {
+			return nil, err
+		}
+	}
+	result.Documents = len(documents)
+	result.Chunks = len(chunks)
+	return result, nil
+}
+
+// deleteStaleChunks deletes the chunks of the document whose index is not less than from
+func (p *Pipeline) deleteStaleChunks(documentID string, from int) error {
+	o := &p.options
+	return api.DeleteRow(p.cli, &api.DeleteRowArgs{
+		Database: o.Database,
+		Table:    o.ChunkTable,
+		Filter: fmt.Sprintf("%s = '%s' AND %s >= %d",
+			o.ParentIDField, escapeFilterString(documentID), o.ChunkIndexField, from),
+	})
+}
+
+// DeleteDocument deletes the chunks and the parent row of the document
+func (p *Pipeline) DeleteDocument(documentID string) error {
+	if err := p.deleteStaleChunks(documentID, 0); err != nil {
+		return err
+	}
+	if len(p.options.ParentTable) == 0 {
+		return nil
+	}
+	return api.DeleteRow(p.cli, &api.DeleteRowArgs{
+		Database:   p.options.Database,
+		Table:      p.options.ParentTable,
+		PrimaryKey: map[string]interface{}{p.options.ParentKeyField: documentID},
+	})
+}
+
+// Retrieve searches the limit chunks closest to the query, the query is embedded by the embedder
+// of the pipeline, and fetches their parents
+func (p *Pipeline) Retrieve(query string, limit uint32) ([]RetrievedChunk, error) {
+	if p.table == nil {
+		return nil, fmt.Errorf("retrieving by query requires an embedder")
+	}
+	result, err := p.table.SearchText(p.options.VectorField, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	if result.Rows == nil {
+		return []RetrievedChunk{}, nil
+	}
+	return p.WithParents(result.Rows.Rows)
+}
+
+// WithParents fetches the parents of the chunk rows found by any search on the chunk table, the
+// rows should retrieve the parent id field
+func (p *Pipeline) WithParents(rows []api.RowResult) ([]RetrievedChunk, error) {
+	o := &p.options
+	chunks := make([]RetrievedChunk, len(rows))
+	for i, row := range rows {
+		chunks[i].RowResult = row
+	}
+	if len(o.ParentTable) == 0 || len(rows) == 0 {
+		return chunks, nil
+	}
+	keys := make([]api.QueryKey, 0, len(rows))
+	for _, row := range rows {
+		parentID, ok := row.Row.Fields[o.ParentIDField]
+		if !ok {
+			return nil, fmt.Errorf("field '%s' is not retrieved", o.ParentIDField)
+		}
+		keys = append(keys, api.QueryKey{PrimaryKey: map[string]interface{}{o.ParentKeyField: parentID}})
+	}
+	parents, err := api.BatchQueryRowByKeys(p.cli, &api.BatchQueryRowArgs{
+		Database: o.Database,
+		Table:    o.ParentTable,
+		Keys:     keys,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range chunks {
+		if parent, ok := parents.Get(keys[i].PrimaryKey); ok {
+			chunks[i].Parent = parent
+		}
+	}
+	return chunks, nil
+}
+
+// ChunkID returns the primary key of the chunk of the document
+func ChunkID(documentID string, index int) string {
+	return fmt.Sprintf("%s#%d", documentID, index)
+}
+
+func escapeFilterString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+func setDefault(field *string, value string) {
+	if len(*field) == 0 {
+		*field = value
+	}
+}
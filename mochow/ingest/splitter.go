@@ -0,0 +1,164 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// splitter.go - split the text of documents into chunks
+
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Splitter splits a text into chunks
+type Splitter interface {
+	Split(text string) ([]string, error)
+}
+
+// CharacterSplitter splits a text into chunks of ChunkSize characters, consecutive chunks share
+// Overlap characters
+type CharacterSplitter struct {
+	ChunkSize int
+	Overlap   int
+}
+
+func (s *CharacterSplitter) Split(text string) ([]string, error) {
+	if err := checkChunkSize(s.ChunkSize, s.Overlap); err != nil {
+		return nil, err
+	}
+	runes := []rune(text)
+	chunks := make([]string, 0)
+	for start := 0; start < len(runes); start += s.ChunkSize - s.Overlap {
+		end := start + s.ChunkSize
+		if end > len(runes) {
+			end = len(runes)
+		}
+		chunks = append(chunks, string(runes[start:end]))
+		if end == len(runes) {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// TokenSplitter splits a text into chunks of ChunkSize tokens, consecutive chunks share Overlap
+// tokens. The tokens are approximated by the words separated by white spaces, the words of a
+// chunk are joined by a single space.
+type TokenSplitter struct {
+	ChunkSize int
+	Overlap   int
+}
+
+func (s *TokenSplitter) Split(text string) ([]string, error) {
+	if err := checkChunkSize(s.ChunkSize, s.Overlap); err != nil {
+		return nil, err
+	}
+	words := strings.Fields(text)
+	chunks := make([]string, 0)
+	for start := 0; start < len(words); start += s.ChunkSize - s.Overlap {
+		end := start + s.ChunkSize
+		if end > len(words) {
+			end = len(words)
+		}
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// SentenceSplitter packs whole sentences into chunks of at most ChunkSize characters, a sentence
+// longer than ChunkSize makes a chunk alone. Consecutive chunks share the trailing sentences
+// of at most Overlap characters.
+type SentenceSplitter struct {
+	ChunkSize int
+	Overlap   int
+}
+
+func (s *SentenceSplitter) Split(text string) ([]string, error) {
+	if err := checkChunkSize(s.ChunkSize, s.Overlap); err != nil {
+		return nil, err
+	}
+	sentences := splitSentences(text)
+	chunks := make([]string, 0)
+	for start := 0; start < len(sentences); {
+		end, size := start, 0
+		for end < len(sentences) {
+			length := len([]rune(sentences[end]))
+			if end > start && size+length > s.ChunkSize {
+				break
+			}
+			size += length
+			end++
+		}
+		chunks = append(chunks, strings.TrimSpace(strings.Join(sentences[start:end], "")))
+		if end == len(sentences) {
+			break
+		}
+		// step back over the sentences shared with the next chunk, keeping progress
+		next, overlap := end, 0
+		for next-1 > start {
+			length := len([]rune(sentences[next-1]))
+			if overlap+length > s.Overlap {
+				break
+			}
+			overlap += length
+			next--
+		}
+		start = next
+	}
+	return chunks, nil
+}
+
+// splitSentences splits the text after the sentence terminators, keeping the terminators and
+// the following spaces with the sentence
+func splitSentences(text string) []string {
+	sentences := make([]string, 0)
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !isSentenceTerminator(runes[i]) {
+			continue
+		}
+		for i+1 < len(runes) && (isSentenceTerminator(runes[i+1]) || unicode.IsSpace(runes[i+1])) {
+			i++
+		}
+		sentences = append(sentences, string(runes[start:i+1]))
+		start = i + 1
+	}
+	if start < len(runes) && len(strings.TrimSpace(string(runes[start:]))) > 0 {
+		sentences = append(sentences, string(runes[start:]))
+	}
+	return sentences
+}
+
+func isSentenceTerminator(r rune) bool {
+	switch r {
+	case '.', '!', '?', '\n', '。', '！', '？', '；':
+		return true
+	}
+	return false
+}
+
+func checkChunkSize(chunkSize, overlap int) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("chunk size should be positive")
+	}
+	if overlap < 0 || overlap >= chunkSize {
+		return fmt.Errorf("overlap should be in [0, chunk size)")
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// http.go - the reranker calling a rerank service over HTTP
+
+// Package rerank implements rerankers which plug into the searches of the api package.
+package rerank
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// DefaultHTTPTimeout is the timeout of a rerank request if no http client is given
+const DefaultHTTPTimeout = 30 * time.Second
+
+// HTTPReranker calls a rerank service speaking the widely used `/v1/rerank` protocol, the request
+// is {"model", "query", "documents", "top_n"} and the response is {"results": [{"index",
+// "relevance_score"}]}. A bare array of {"index", "score"} is accepted as well. The documents
+// are the values of TextField of the candidate rows, so the field should be projected.
+type HTTPReranker struct {
+	Endpoint   string
+	APIKey     string // sent as bearer token if not empty
+	Model      string
+	TextField  string
+	HTTPClient *http.Client
+}
+
+type rerankRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+type rerankScore struct {
+	Index          int      `json:"index"`
+	RelevanceScore *float64 `json:"relevance_score"`
+	Score          *float64 `json:"score"`
+}
+
+type rerankResponse struct {
+	Results []rerankScore `json:"results"`
+}
+
+func NewHTTPReranker(endpoint, model, textField string) *HTTPReranker {
+	return &HTTPReranker{
+		Endpoint:  endpoint,
+		Model:     model,
+		TextField: textField,
+	}
+}
+
+// Rerank sends the candidates to the rerank service and returns the candidates scored by the
+// service, candidates which are not scored are dropped
+func (r *HTTPReranker) Rerank(query string, candidates []api.RowResult) ([]api.RowResult, error) {
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+	documents := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		switch v := candidate.Row.Fields[r.TextField].(type) {
+		case nil:
+			return nil, fmt.Errorf("field '%s' is not retrieved", r.TextField)
+		case string:
+			documents[i] = v
+		default:
+			documents[i] = fmt.Sprint(v)
+		}
+	}
+	body, err := sonic.Marshal(&rerankRequest{
+		Model:     r.Model,
+		Query:     query,
+		Documents: documents,
+		TopN:      len(documents),
+	})
+	if err != nil {
+		return nil, err
+	}
+	scores, err := r.send(body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]api.RowResult, 0, len(scores))
+	for _, score := range scores {
+		if score.Index < 0 || score.Index >= len(candidates) {
+			return nil, fmt.Errorf("rerank service returned invalid index %d", score.Index)
+		}
+		row := candidates[score.Index]
+		switch {
+		case score.RelevanceScore != nil:
+			row.Score = *score.RelevanceScore
+		case score.Score != nil:
+			row.Score = *score.Score
+		default:
+			return nil, fmt.Errorf("rerank service returned no score for index %d", score.Index)
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+func (r *HTTPReranker) send(body []byte) ([]rerankScore, error) {
+	req, err := http.NewRequest(http.MethodPost, r.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(r.APIKey) > 0 {
+		req.Header.Set("Authorization", "Bearer "+r.APIKey)
+	}
+	httpClient := r.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultHTTPTimeout}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("rerank request failed with status %d: %s", resp.StatusCode, data)
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var scores []rerankScore
+		if err := sonic.Unmarshal(data, &scores); err != nil {
+			return nil, err
+		}
+		return scores, nil
+	}
+	var response rerankResponse
+	if err := sonic.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	return response.Results, nil
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// http_test.go - test the HTTP reranker against a local stub
+
+package rerank
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+// newStub scores the documents by their length, longer first. The response is a bare array of
+// {"index", "score"} if bare is set.
+func newStub(t *testing.T, bare bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("unexpected authorization %q", auth)
+		}
+		var request rerankRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		if request.Query != "q" || request.Model != "m" || request.TopN != len(request.Documents) {
+			t.Errorf("unexpected request %+v", request)
+		}
+		results := make([]map[string]interface{}, 0, len(request.Documents))
+		for i := len(request.Documents) - 1; i >= 0; i-- {
+			if strings.HasPrefix(request.Documents[i], "drop") {
+				continue
+			}
+			key := "relevance_score"
+			if bare {
+				key = "score"
+			}
+			results = append(results, map[string]interface{}{"index": i, key: len(request.Documents[i])})
+		}
+		if bare {
+			json.NewEncoder(w).Encode(results)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+}
+
+func candidates(texts ...string) []api.RowResult {
+	rows := make([]api.RowResult, len(texts))
+	for i, text := range texts {
+		rows[i] = api.RowResult{Row: api.Row{Fields: map[string]interface{}{"id": i, "text": text}}}
+	}
+	return rows
+}
+
+func TestRerank(t *testing.T) {
+	for _, bare := range []bool{false, true} {
+		stub := newStub(t, bare)
+		reranker := NewHTTPReranker(stub.URL, "m", "text")
+		reranker.APIKey = "key"
+
+		rows, err := reranker.Rerank("q", candidates("a", "ccc", "drop it", "bb"))
+		stub.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 {
+			t.Fatalf("expected 3 rows, got %d", len(rows))
+		}
+		for i, id := range []int{3, 1, 0} {
+			if rows[i].Row.Fields["id"] != id {
+				t.Errorf("row %d is %v", i, rows[i].Row.Fields)
+			}
+		}
+		if rows[1].Score != 3 {
+			t.Errorf("expected score 3, got %v", rows[1].Score)
+		}
+	}
+}
+
+func TestRerankErrors(t *testing.T) {
+	reranker := NewHTTPReranker("http://127.0.0.1:1", "m", "text")
+	if rows, err := reranker.Rerank("q", nil); err != nil || len(rows) != 0 {
+		t.Errorf("expected no row, got %v %v", rows, err)
+	}
+	if _, err := NewHTTPReranker("", "m", "missing").Rerank("q", candidates("a")); err == nil {
+		t.Error("expected an error for a field not retrieved")
+	}
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("bad request"))
+	}))
+	defer stub.Close()
+	reranker = NewHTTPReranker(stub.URL, "m", "text")
+	if _, err := reranker.Rerank("q", candidates("a")); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("expected an error with the status, got %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// encoder.go - encode texts into sparse vectors weighted by BM25 or TF-IDF
+
+// Package sparse implements the encoders producing api.SparseFloatVector from texts, e.g. for the
+// SPARSE_OPTIMIZED_FLAT indexes.
+package sparse
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/baidu/mochow-sdk-go/v2/client"
+	"github.com/baidu/mochow-sdk-go/v2/mochow/api"
+)
+
+const (
+	DefaultK1 = 1.2
+	DefaultB  = 0.75
+)
+
+type Weighting string
+
+const (
+	// WeightingBM25 weights the terms of documents by the BM25 term frequency saturation and the
+	// terms of queries by their inverse document frequency, the dot product is the BM25 score
+	WeightingBM25 Weighting = "BM25"
+	// WeightingTFIDF weights the terms of documents and queries by (1 + ln(tf)) * idf
+	WeightingTFIDF Weighting = "TFIDF"
+)
+
+// Encoder learns the vocabulary and the document frequencies of the terms from a corpus. The
+// dimensions of the sparse vectors are the ids of the terms in the vocabulary, terms not in the
+// vocabulary are dropped.
+type Encoder struct {
+	tokenizer Tokenizer
+	stats     encoderStats
+}
+
+// encoderStats are the statistics persisted by Save
+type encoderStats struct {
+	Weighting   Weighting      `json:"weighting"`
+	K1          float64        `json:"k1"`
+	B           float64        `json:"b"`
+	DocCount    int64          `json:"docCount"`
+	TotalLength int64          `json:"totalLength"`
+	Vocabulary  map[string]int `json:"vocabulary"`
+	DocFreq     map[string]int `json:"docFreq"`
+}
+
+// NewEncoder returns an empty encoder, the tokenizer defaults to WhitespaceTokenizer
+func NewEncoder(tokenizer Tokenizer, weighting Weighting) (*Encoder, error) {
+	if tokenizer == nil {
+		tokenizer = &WhitespaceTokenizer{}
+	}
+	if weighting != WeightingBM25 && weighting != WeightingTFIDF {
+		return nil, fmt.Errorf("unsupported weighting '%s'", weighting)
+	}
+	return &Encoder{
+		tokenizer: tokenizer,
+		stats: encoderStats{
+			Weighting:  weighting,
+			K1:         DefaultK1,
+			B:          DefaultB,
+			Vocabulary: make(map[string]int),
+			DocFreq:    make(map[string]int),
+		},
+	}, nil
+}
+
+// SetBM25Params overrides the k1 and b parameters of BM25
+func (e *Encoder) SetBM25Params(k1, b float64) {
+	e.stats.K1 = k1
+	e.stats.B = b
+}
+
+// Fit adds the documents to the statistics, it could be called repeatedly. The new terms get
+// their ids in the order they first appear, so that fitting the same texts gives the same ids.
+func (e *Encoder) Fit(texts []string) {
+	for _, text := range texts {
+		terms := e.tokenizer.Tokenize(text)
+		e.stats.DocCount++
+		e.stats.TotalLength += int64(len(terms))
+		for _, term := range terms {
+			if _, ok := e.stats.Vocabulary[term]; !ok {
+				e.stats.Vocabulary[term] = len(e.stats.Vocabulary)
+			}
+		}
+		for term := range termFrequencies(terms) {
+			e.stats.DocFreq[term]++
+		}
+	}
+}
+
+// FitTableArgs scans the text field of the rows matching the filter
+type FitTableArgs struct {
+	Database        string
+	Table           string
+	TextField       string
+	Filter          string
+	BatchSize       uint64
+	ReadConsistency api.ReadConsistency
+}
+
+// FitTable adds the texts stored in the table to the statistics
+func (e *Encoder) FitTable(cli client.Client, args *FitTableArgs) error {
+	it := api.NewSelectIterator(cli, &api.SelectRowArgs{
+		Database:        args.Database,
+		Table:           args.Table,
+		Filter:          args.Filter,
+		Limit:           args.BatchSize,
+		Projections:     []string{args.TextField},
+		ReadConsistency: args.ReadConsistency,
+	})
+	defer it.Close()
+	for {
+		rows, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if rows == nil {
+			return nil
+		}
+		texts := make([]string, 0, len(rows))
+		for _, row := range rows {
+			if text, ok := row.Fields[args.TextField].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+		e.Fit(texts)
+	}
+}
+
+// EncodeDocument returns the sparse vector of a document to store
+func (e *Encoder) EncodeDocument(text string) api.SparseFloatVector {
+	terms := e.tokenizer.Tokenize(text)
+	vector := make(api.SparseFloatVector)
+	avgLength := 1.0
+	if e.stats.DocCount > 0 && e.stats.TotalLength > 0 {
+		avgLength = float64(e.stats.TotalLength) / float64(e.stats.DocCount)
+	}
+	for term, tf := range termFrequencies(terms) {
+		id, ok := e.stats.Vocabulary[term]
+		if !ok {
+			continue
+		}
+		var weight float64
+		if e.stats.Weighting == WeightingBM25 {
+			k1, b := e.stats.K1, e.stats.B
+			weight = tf * (k1 + 1) / (tf + k1*(1-b+b*float64(len(terms))/avgLength))
+		} else {
+			weight = (1 + math.Log(tf)) * e.idf(term)
+		}
+		vector[strconv.Itoa(id)] = float32(weight)
+	}
+	return vector
+}
+
+// EncodeQuery returns the sparse vector of a query to search
+func (e *Encoder) EncodeQuery(text string) api.SparseFloatVector {
+	vector := make(api.SparseFloatVector)
+	for term, tf := range termFrequencies(e.tokenizer.Tokenize(text)) {
+		id, ok := e.stats.Vocabulary[term]
+		if !ok {
+			continue
+		}
+		weight := e.idf(term)
+		if e.stats.Weighting == WeightingTFIDF {
+			weight *= 1 + math.Log(tf)
+		}
+		vector[strconv.Itoa(id)] = float32(weight)
+	}
+	return vector
+}
+
+// Embed implements api.Embedder by encoding the texts as documents, so that the encoder could
+// fill a sparse vector field of an api.EmbeddingTable
+func (e *Encoder) Embed(texts []string) ([]api.Vector, error) {
+	vectors := make([]api.Vector, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.EncodeDocument(text)
+	}
+	return vectors, nil
+}
+
+// idf is the BM25 inverse document frequency, which is always positive
+func (e *Encoder) idf(term string) float64 {
+	n := float64(e.stats.DocCount)
+	df := float64(e.stats.DocFreq[term])
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// VocabularySize returns the number of terms learned
+func (e *Encoder) VocabularySize() int {
+	return len(e.stats.Vocabulary)
+}
+
+// Save writes the statistics to the file as JSON, the tokenizer is not saved
+func (e *Encoder) Save(path string) error {
+	data, err := sonic.Marshal(&e.stats)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// LoadEncoder reads the statistics saved by Save, the tokenizer should be the one used to fit
+func LoadEncoder(path string, tokenizer Tokenizer) (*Encoder, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	e, err := NewEncoder(tokenizer, WeightingBM25)
+	if err != nil {
+		return nil, err
+	}
+	if err := sonic.Unmarshal(data, &e.stats); err != nil {
+		return nil, err
+	}
+	if e.stats.Weighting != WeightingBM25 && e.stats.Weighting != WeightingTFIDF {
+		return nil, fmt.Errorf("unsupported weighting '%s'", e.stats.Weighting)
+	}
+	if e.stats.Vocabulary == nil {
+		e.stats.Vocabulary = make(map[string]int)
+	}
+	if e.stats.DocFreq == nil {
+		e.stats.DocFreq = make(map[string]int)
+	}
+	return e, nil
+}
+
+func termFrequencies(terms []string) map[string]float64 {
+	frequencies := make(map[string]float64, len(terms))
+	for _, term := range terms {
+		frequencies[term]++
+	}
+	return frequencies
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2024 Baidu, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions
+ * and limitations under the License.
+ */
+
+// tokenizer.go - simple tokenizers for the sparse encoder
+
+package sparse
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenizer splits a text into terms
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// WhitespaceTokenizer lowercases the text and splits it into the runs of letters and digits
+type WhitespaceTokenizer struct{}
+
+func (t *WhitespaceTokenizer) Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+type CJKMode int
+
+const (
+	CJKUnigram CJKMode = iota
+	CJKBigram
+	CJKUnigramBigram
+)
+
+// CJKTokenizer splits the runs of CJK characters into unigrams, bigrams or both as set by Mode,
+// a run of a single character always gives its unigram. The other text is tokenized as
+// WhitespaceTokenizer does.
+type CJKTokenizer struct {
+	Mode CJKMode
+}
+
+func (t *CJKTokenizer) Tokenize(text string) []string {
+	tokens := make([]string, 0)
+	var word, cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 0 {
+			return
+		}
+		if t.Mode != CJKBigram || len(cjk) == 1 {
+			for _, r := range cjk {
+				tokens = append(tokens, string(r))
+			}
+		}
+		if t.Mode != CJKUnigram {
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}